@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 
 	chi "github.com/go-chi/chi/v5"
 	middleware "github.com/go-chi/chi/v5/middleware"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/redhatinsights/export-service-go/config"
 	"github.com/redhatinsights/export-service-go/db"
+	"github.com/redhatinsights/export-service-go/events"
 	"github.com/redhatinsights/export-service-go/exports"
 	ekafka "github.com/redhatinsights/export-service-go/kafka"
 	"github.com/redhatinsights/export-service-go/logger"
@@ -33,6 +35,7 @@ import (
 	emiddleware "github.com/redhatinsights/export-service-go/middleware"
 	"github.com/redhatinsights/export-service-go/models"
 	es3 "github.com/redhatinsights/export-service-go/s3"
+	"github.com/redhatinsights/export-service-go/webhooks"
 	"golang.org/x/time/rate"
 )
 
@@ -65,6 +68,7 @@ func createPublicServer(cfg *config.ExportConfig, external exports.Export) *http
 		// add external routes
 		r.Get("/ping", helloWorld) // Hello World endpoint
 		r.Route("/exports", external.ExportRouter)
+		r.Route("/applications", external.ApplicationRouter)
 	})
 
 	server := http.Server{
@@ -193,8 +197,17 @@ func startApiServer(cfg *config.ExportConfig, log *zap.SugaredLogger) {
 		"exportableApplications", cfg.ExportableApplications,
 		"aws_uploader_buffer_size", cfg.StorageConfig.AwsUploaderBufferSize,
 		"aws_downloader_buffer_size", cfg.StorageConfig.AwsDownloaderBufferSize,
-		"rate_limit_rate", cfg.RateLimitConfig.Rate,
-		"rate_limit_burst", cfg.RateLimitConfig.Burst,
+		"presigned_url_expiry", cfg.StorageConfig.PresignedURLExpiry,
+		"retry_policies", cfg.RetryPolicies,
+		"events_heartbeat_interval", cfg.EventsHeartbeatInterval,
+		"webhook_timeout", cfg.WebhookConfig.Timeout,
+		"webhook_allowed_hosts", cfg.WebhookConfig.AllowedHosts,
+		"webhook_retry_policy", cfg.WebhookConfig.RetryPolicy,
+		"quota", cfg.Quota,
+		"quota_overrides", cfg.QuotaOverrides,
+		"rate_limit_create", cfg.RateLimitConfig.Create,
+		"rate_limit_list", cfg.RateLimitConfig.List,
+		"rate_limit_download", cfg.RateLimitConfig.Download,
 	)
 
 	kafkaProducerMessagesChan := make(chan *kafka.Message) // TODO: determine an appropriate buffer (if one is actually necessary)
@@ -204,17 +217,27 @@ func startApiServer(cfg *config.ExportConfig, log *zap.SugaredLogger) {
 		log.Panic("failed to create kafka producer", "error", err)
 	}
 	log.Infof("created kafka producer: %s", producer.String())
-	go producer.StartProducer(kafkaProducerMessagesChan)
+	producerDone := make(chan struct{})
+	go func() {
+		producer.StartProducer(kafkaProducerMessagesChan)
+		close(producerDone)
+	}()
 
 	DB, err := db.OpenDB(*cfg)
 	if err != nil {
 		log.Panic("failed to open database", "error", err)
 	}
 
-	kafkaRequestAppResources := exports.KafkaRequestApplicationResources(kafkaProducerMessagesChan)
+	// requests and cancellations are sent to the producer in the background
+	var sending sync.WaitGroup
+	kafkaRequestAppResources := exports.KafkaRequestApplicationResources(kafkaProducerMessagesChan, &sending)
+	kafkaCancelAppResources := exports.KafkaCancelApplicationResources(kafkaProducerMessagesChan, &sending)
+	kafkaPublishLifecycleEvent := exports.KafkaPublishLifecycleEvent(kafkaProducerMessagesChan)
 
 	s3Client := es3.NewS3Client(*cfg, log)
 
+	webhookSender := webhooks.NewSender(&models.ExportDB{DB: DB, Cfg: cfg}, log, cfg.WebhookConfig.Timeout, cfg.WebhookConfig.RetryPolicy)
+
 	storageHandler := es3.Compressor{
 		Bucket: cfg.StorageConfig.Bucket,
 		Log:    log,
@@ -223,18 +246,44 @@ func startApiServer(cfg *config.ExportConfig, log *zap.SugaredLogger) {
 		TMClient: transfermanager.New(s3Client, func(o *transfermanager.Options) {
 			o.PartSizeBytes = cfg.StorageConfig.AwsUploaderBufferSize
 		}),
+		Notifiers: []es3.ExportNotifier{
+			webhookSender,
+			&exports.LifecycleNotifier{
+				DB:                    &models.ExportDB{DB: DB, Cfg: cfg},
+				Log:                   log,
+				PublishLifecycleEvent: kafkaPublishLifecycleEvent,
+			},
+		},
 	}
 
-	rateLimiter := rate.NewLimiter(rate.Limit(cfg.RateLimitConfig.Rate), cfg.RateLimitConfig.Burst)
+	// the status events are relayed from Postgres until the servers shut down
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	eventBroker := events.NewBroker(log)
+	go func() {
+		if err := eventBroker.Listen(eventsCtx, db.NewListener(*cfg, log)); err != nil {
+			log.Errorw("failed to listen for status events", "error", err)
+		}
+	}()
+
+	rateLimits := emiddleware.RateLimits{
+		Create:   emiddleware.NewRateLimiter("create", rate.Limit(cfg.RateLimitConfig.Create.Rate), cfg.RateLimitConfig.Create.Burst),
+		List:     emiddleware.NewRateLimiter("list", rate.Limit(cfg.RateLimitConfig.List.Rate), cfg.RateLimitConfig.List.Burst),
+		Download: emiddleware.NewRateLimiter("download", rate.Limit(cfg.RateLimitConfig.Download.Rate), cfg.RateLimitConfig.Download.Burst),
+	}
 	external := exports.Export{
-		Bucket:              cfg.StorageConfig.Bucket,
-		StorageHandler:      &storageHandler,
-		DB:                  &models.ExportDB{DB: DB, Cfg: cfg},
-		RequestAppResources: kafkaRequestAppResources,
-		Log:                 log,
-		RateLimiter:         rateLimiter,
+		Bucket:                cfg.StorageConfig.Bucket,
+		StorageHandler:        &storageHandler,
+		DB:                    &models.ExportDB{DB: DB, Cfg: cfg},
+		RequestAppResources:   kafkaRequestAppResources,
+		CancelAppResources:    kafkaCancelAppResources,
+		PublishLifecycleEvent: kafkaPublishLifecycleEvent,
+		Events:                eventBroker,
+		Log:                   log,
+		RateLimits:            rateLimits,
 	}
 	wsrv := createPublicServer(cfg, external)
+	wsrv.RegisterOnShutdown(eventBroker.Close)
 
 	var pskMiddleware func(http.Handler) http.Handler
 	if !cfg.DisableServiceToServicePSKAuth && len(cfg.PskMap) > 0 {
@@ -294,7 +343,20 @@ func startApiServer(cfg *config.ExportConfig, log *zap.SugaredLogger) {
 
 	<-idleConnsClosed
 
+	// exports which are still being compressed publish their lifecycle
+	// events and notify their webhooks once they are finished
+	storageHandler.Wait()
+	log.Info("finished compressing exports")
+
+	// notifications still waiting to be retried are abandoned
+	webhookSender.Close()
+	log.Info("stopped webhook sender")
+
+	// every message has been handed to the producer, wait until they are
+	// delivered before the producer is closed
+	sending.Wait()
 	close(kafkaProducerMessagesChan)
+	<-producerDone
 
 	log.Info("flushing kafka producer")
 	producer.Flush(1500) // 1.5 second timeout
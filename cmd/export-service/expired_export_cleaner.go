@@ -1,8 +1,12 @@
 package main
 
 import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
 	"github.com/redhatinsights/export-service-go/config"
 	"github.com/redhatinsights/export-service-go/db"
+	"github.com/redhatinsights/export-service-go/exports"
+	ekafka "github.com/redhatinsights/export-service-go/kafka"
 	"github.com/redhatinsights/export-service-go/models"
 
 	"go.uber.org/zap"
@@ -11,6 +15,19 @@ import (
 func startExpiredExportCleaner(cfg *config.ExportConfig, log *zap.SugaredLogger) {
 	log.Info("Starting expired export cleaner")
 
+	kafkaProducerMessagesChan := make(chan *kafka.Message)
+
+	producer, err := ekafka.NewProducer()
+	if err != nil {
+		log.Panic("failed to create kafka producer", "error", err)
+	}
+	producerDone := make(chan struct{})
+	go func() {
+		producer.StartProducer(kafkaProducerMessagesChan)
+		close(producerDone)
+	}()
+	publishLifecycleEvent := exports.KafkaPublishLifecycleEvent(kafkaProducerMessagesChan)
+
 	dbConnection, err := db.OpenDB(*cfg)
 	if err != nil {
 		log.Panic("failed to open database", "error", err)
@@ -21,8 +38,47 @@ func startExpiredExportCleaner(cfg *config.ExportConfig, log *zap.SugaredLogger)
 		Cfg: cfg,
 	}
 
-	err = exportsDB.DeleteExpiredExports()
+	// an export is only marked as announced once its event was delivered, so
+	// that the next run announces it again otherwise
+	expiring, err := exportsDB.ExpiringExports(cfg.ExportExpiringNotice)
+	if err != nil {
+		log.Errorw("Failed to find expiring exports", "error", err)
+	}
+	for _, export := range expiring {
+		if err := deliverLifecycleEvent(producer, exports.ExportExpiring, export); err != nil {
+			log.Errorw("Failed to publish expiring event", "export_id", export.ID, "error", err)
+			continue
+		}
+		if err := exportsDB.MarkExpiryNotified(export); err != nil {
+			log.Errorw("Failed to mark export as announced expiring", "export_id", export.ID, "error", err)
+		}
+	}
+
+	deleted, err := exportsDB.DeleteExpiredExports()
 	if err != nil {
 		log.Error("Expired export cleaner failed", "error", err)
 	}
+	for _, export := range deleted {
+		publishLifecycleEvent(log, exports.ExportDeleted, export)
+	}
+
+	// every message has been handed to the producer, wait until they are
+	// delivered before the producer is closed
+	close(kafkaProducerMessagesChan)
+	<-producerDone
+
+	log.Info("flushing kafka producer")
+	producer.Flush(15000) // 15 second timeout
+	producer.Close()
+	log.Info("closed kafka producer")
+}
+
+// deliverLifecycleEvent publishes a lifecycle event of the export and waits
+// until it is delivered.
+func deliverLifecycleEvent(producer *ekafka.Producer, event string, export models.ExportPayload) error {
+	msg, err := exports.NewLifecycleMessage(event, export)
+	if err != nil || msg == nil {
+		return err
+	}
+	return producer.Deliver(msg)
 }
@@ -37,6 +37,29 @@ func createRootCommand(cfg *config.ExportConfig, log *zap.SugaredLogger) *cobra.
 
 	rootCmd.AddCommand(apiServerCmd)
 
+	schedulerCmd := &cobra.Command{
+		Use:   "scheduler",
+		Short: "Run the export scheduler",
+		Run: func(cmd *cobra.Command, args []string) {
+			startScheduler(cfg, log)
+		},
+	}
+
+	rootCmd.AddCommand(schedulerCmd)
+
+	var publicKey string
+	verifyArchiveCmd := &cobra.Command{
+		Use:   "verify-archive <archive>",
+		Short: "Verify the checksums and signature of a downloaded export archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return verifyArchive(cfg, args[0], publicKey)
+		},
+	}
+	verifyArchiveCmd.Flags().StringVar(&publicKey, "public-key", "", "base64 encoded ed25519 public key of the service, defaults to the public part of ARCHIVE_SIGNING_KEY")
+
+	rootCmd.AddCommand(verifyArchiveCmd)
+
 	migrateDbCmd := &cobra.Command{
 		Use:   "migrate_db",
 		Short: "Run the db migration",
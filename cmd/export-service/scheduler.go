@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/db"
+	"github.com/redhatinsights/export-service-go/exports"
+	ekafka "github.com/redhatinsights/export-service-go/kafka"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+func startScheduler(cfg *config.ExportConfig, log *zap.SugaredLogger) {
+	log.Infow("Starting export scheduler", "scheduler_interval", cfg.SchedulerInterval, "retry_lease", cfg.RetryLease)
+
+	kafkaProducerMessagesChan := make(chan *kafka.Message)
+
+	producer, err := ekafka.NewProducer()
+	if err != nil {
+		log.Panic("failed to create kafka producer", "error", err)
+	}
+	log.Infof("created kafka producer: %s", producer.String())
+	producerDone := make(chan struct{})
+	go func() {
+		producer.StartProducer(kafkaProducerMessagesChan)
+		close(producerDone)
+	}()
+
+	dbConnection, err := db.OpenDB(*cfg)
+	if err != nil {
+		log.Panic("failed to open database", "error", err)
+	}
+
+	var sending sync.WaitGroup
+	scheduler := exports.Scheduler{
+		DB:                    &models.ExportDB{DB: dbConnection, Cfg: cfg},
+		Log:                   log,
+		RequestAppResources:   exports.KafkaRequestApplicationResources(kafkaProducerMessagesChan, &sending),
+		PublishLifecycleEvent: exports.KafkaPublishLifecycleEvent(kafkaProducerMessagesChan),
+		Interval:              cfg.SchedulerInterval,
+		RetryLease:            cfg.RetryLease,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheduler.Start(ctx)
+	log.Info("export scheduler stopped")
+
+	// every message has been handed to the producer, wait until they are
+	// delivered before the producer is closed
+	sending.Wait()
+	close(kafkaProducerMessagesChan)
+	<-producerDone
+
+	log.Info("flushing kafka producer")
+	producer.Flush(1500) // 1.5 second timeout
+	producer.Close()
+	log.Info("closed kafka producer")
+}
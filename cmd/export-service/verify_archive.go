@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/redhatinsights/export-service-go/config"
+	es3 "github.com/redhatinsights/export-service-go/s3"
+)
+
+// verifyArchive verifies the checksums of the files of a downloaded archive,
+// and the signature of its meta.json with the base64 encoded publicKey, or the
+// public part of the configured signing key.
+func verifyArchive(cfg *config.ExportConfig, path, publicKey string) error {
+	var key ed25519.PublicKey
+	switch {
+	case publicKey != "":
+		decoded, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			return fmt.Errorf("the public key must be a base64 encoded %d byte ed25519 public key", ed25519.PublicKeySize)
+		}
+		key = decoded
+	case cfg.ArchiveConfig.SigningKey != nil:
+		key = cfg.ArchiveConfig.SigningKey.Public().(ed25519.PublicKey)
+	}
+
+	meta, err := es3.VerifyArchive(path, key)
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		fmt.Println("WARNING: no public key is configured, the signature of meta.json was not verified")
+	} else {
+		fmt.Println("the signature of meta.json is valid")
+	}
+	fmt.Printf("%d files match their checksums\n", len(meta.FileMeta))
+	return nil
+}
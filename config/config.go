@@ -5,19 +5,28 @@ SPDX-License-Identifier: Apache-2.0
 package config
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	clowder "github.com/redhatinsights/app-common-go/pkg/api/v1"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/spf13/viper"
 )
 
 const ExportTopic string = "platform.export.requests"
 
+// LifecycleTopic receives an event whenever an export is created, finished,
+// about to expire or deleted.
+const LifecycleTopic string = "platform.export.lifecycle"
+
 // ExportConfig represents the runtime configuration
 type ExportConfig struct {
 	Hostname                      string
@@ -33,6 +42,7 @@ type ExportConfig struct {
 	Debug                         bool
 	DBConfig                      dbConfig
 	StorageConfig                 storageConfig
+	ArchiveConfig                 archiveConfig
 	KafkaConfig                   kafkaConfig
 	RateLimitConfig               rateLimitConfig
 	OpenAPIPrivatePath            string
@@ -41,8 +51,20 @@ type ExportConfig struct {
 	Psks                          []string
 	PskMap                        map[string]string
 	ExportExpiryDays              int
+	ExportMaxExpiryDays           int
 	ExportableApplications        map[string]map[string]bool
+	ExportableResources           map[string]map[string]ExportableResource
 	MaxPayloadSize                int
+	RetryPolicies                 map[string]RetryPolicy
+	SchedulerInterval             time.Duration
+	RetryLease                    time.Duration
+	ScheduleIdentityTTL           time.Duration
+	IdempotencyWindow             time.Duration
+	EventsHeartbeatInterval       time.Duration
+	ExportExpiringNotice          time.Duration
+	WebhookConfig                 webhookConfig
+	Quota                         Quota
+	QuotaOverrides                map[string]Quota
 }
 
 type dbConfig struct {
@@ -76,6 +98,13 @@ type kafkaConfig struct {
 	EventType        string
 	EventDataSchema  string
 	EventSchema      string
+
+	EventCancelType       string
+	EventCancelDataSchema string
+
+	LifecycleTopic           string
+	EventLifecycleType       string
+	EventLifecycleDataSchema string
 }
 
 type kafkaSSLConfig struct {
@@ -95,13 +124,125 @@ type storageConfig struct {
 	UseSSL                  bool
 	AwsUploaderBufferSize   int64
 	AwsDownloaderBufferSize int64
+	// DownloadConcurrency is the number of source objects of an export that
+	// are downloaded at the same time while it is compressed
+	DownloadConcurrency int
+	PresignedURLExpiry  time.Duration
+}
+
+// archiveConfig are the compression levels of the archives of exports.
+type archiveConfig struct {
+	// ZipLevel and GzipLevel range from 0, no compression, to 9
+	ZipLevel  int
+	GzipLevel int
+	// ZstdLevel ranges from 1 to 22
+	ZstdLevel int
+	// SigningKey signs the meta.json of every archive, if it is set
+	SigningKey ed25519.PrivateKey
+	// PasswordKey is the AES-256 key that the keys derived from zip passwords
+	// are wrapped with while they are stored. Exports can only be encrypted
+	// with a password if it is set.
+	PasswordKey []byte
+}
+
+// RetryPolicy describes how often a resource is requested again from an
+// application after the application reports an error for it.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a resource is requested,
+	// including the first request.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every
+	// further attempt, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// ErrorCodes limits retries to errors with one of these codes. Every error
+	// is retried when it is empty.
+	ErrorCodes []int
+}
+
+// Retries reports whether a resource that failed with code after the given
+// number of attempts should be requested again.
+func (rp RetryPolicy) Retries(code, attempts int) bool {
+	if attempts >= rp.MaxAttempts {
+		return false
+	}
+	return len(rp.ErrorCodes) == 0 || slices.Contains(rp.ErrorCodes, code)
+}
+
+// Delay returns how long to wait before requesting a resource again after the
+// given number of attempts.
+func (rp RetryPolicy) Delay(attempts int) time.Duration {
+	delay := rp.Backoff
+	for i := 1; i < attempts && delay < rp.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, rp.MaxBackoff)
+}
+
+// ExportableResource is the configuration of a resource in EXPORT_ENABLE_APPS.
+type ExportableResource struct {
+	// Description tells users what the resource contains.
+	Description string `json:"description,omitempty"`
+	// Formats limits the formats that the resource can be exported in. Every
+	// format is supported when it is empty.
+	Formats []string `json:"formats,omitempty"`
+	// NativeFormats are the formats that the application produces itself,
+	// csv and json when it is empty. Other formats are requested as json, or
+	// csv, and converted by the service, which also renders every pdf.
+	NativeFormats []string `json:"native_formats,omitempty"`
+	// ExpiryDays is how long exports of the resource are kept by default,
+	// instead of ExportExpiryDays.
+	ExpiryDays int `json:"expiry_days,omitempty"`
+	// FilterSchema is the JSON Schema that the filters of the resource have
+	// to match, if any.
+	FilterSchema json.RawMessage `json:"filter_schema,omitempty"`
+	// Schema is FilterSchema compiled for validation.
+	Schema *jsonschema.Schema `json:"-"`
+}
+
+// Quota limits the exports of an organization. A limit of zero is unlimited.
+type Quota struct {
+	// MaxInFlight is the number of exports which may be pending or running.
+	MaxInFlight int64 `json:"max_in_flight"`
+	// MaxDaily is the number of exports which may be created within 24 hours.
+	MaxDaily int64 `json:"max_daily"`
+	// MaxStoredBytes is the total size of the archives which may be stored.
+	MaxStoredBytes int64 `json:"max_stored_bytes"`
 }
 
+// QuotaFor returns the quota of the organization, which is the default quota
+// unless it is overridden for the organization.
+func (ec *ExportConfig) QuotaFor(orgID string) Quota {
+	if quota, ok := ec.QuotaOverrides[orgID]; ok {
+		return quota
+	}
+	return ec.Quota
+}
+
+// rateLimitConfig has the rate limits of each user for the classes of
+// requests to the public API.
 type rateLimitConfig struct {
-	Rate  int
+	Create   RateLimit
+	List     RateLimit
+	Download RateLimit
+}
+
+// RateLimit allows Rate requests per second, with bursts of up to Burst
+// requests.
+type RateLimit struct {
+	Rate  float64
 	Burst int
 }
 
+type webhookConfig struct {
+	Timeout time.Duration
+	// AllowedHosts limits the hosts that callbacks are sent to. Any public
+	// host is allowed when it is empty, which should only be the case in
+	// development.
+	AllowedHosts []string
+	RetryPolicy  RetryPolicy
+}
+
 var (
 	config *ExportConfig
 	doOnce sync.Once
@@ -124,9 +265,20 @@ func Get() *ExportConfig {
 		options.SetDefault("OPEN_API_PRIVATE_PATH", "./static/spec/private.json")
 		// PSK values are parsed from EXPORTS_PSKS env var by parsePSKs()
 		options.SetDefault("EXPORT_EXPIRY_DAYS", 7)
+		options.SetDefault("EXPORT_MAX_EXPIRY_DAYS", 30)
 		options.SetDefault("EXPORT_ENABLE_APPS", "{\"exampleApp\":[\"exampleResource\", \"anotherExampleResource\"]}")
 		options.SetDefault("MAX_PAYLOAD_SIZE", 500)
 		options.SetDefault("DISABLE_SERVICE_TO_SERVICE_PSK_AUTH", false)
+		options.SetDefault("SCHEDULER_INTERVAL", time.Minute)
+		options.SetDefault("EXPORT_RETRY_LEASE", time.Hour)
+		options.SetDefault("SCHEDULE_IDENTITY_TTL", 30*24*time.Hour)
+		options.SetDefault("EXPORT_IDEMPOTENCY_WINDOW", 24*time.Hour)
+		options.SetDefault("EVENTS_HEARTBEAT_INTERVAL", 15*time.Second)
+		options.SetDefault("EXPORT_EXPIRING_NOTICE", 24*time.Hour)
+		// quota overrides are parsed from EXPORT_QUOTA_OVERRIDES env var by parseQuotaOverrides()
+		options.SetDefault("EXPORT_QUOTA_MAX_IN_FLIGHT", 0)
+		options.SetDefault("EXPORT_QUOTA_MAX_DAILY", 0)
+		options.SetDefault("EXPORT_QUOTA_MAX_STORED_BYTES", 0)
 
 		// DB defaults
 		options.SetDefault("PGSQL_USER", "postgres")
@@ -149,13 +301,35 @@ func Get() *ExportConfig {
 		options.SetDefault("KAFKA_EVENT_TYPE", "com.redhat.console.export-service.request")
 		options.SetDefault("KAFKA_EVENT_DATASCHEMA", "https://console.redhat.com/api/schemas/apps/export-service/v1/resource-request.json")
 		options.SetDefault("KAFKA_EVENT_SCHEMA", "https://console.redhat.com/api/schemas/events/v1/events.json")
+		options.SetDefault("KAFKA_EVENT_CANCEL_TYPE", "com.redhat.console.export-service.cancel")
+		options.SetDefault("KAFKA_EVENT_CANCEL_DATASCHEMA", "https://console.redhat.com/api/schemas/apps/export-service/v1/resource-cancellation.json")
+		options.SetDefault("KAFKA_LIFECYCLE_TOPIC", LifecycleTopic)
+		options.SetDefault("KAFKA_EVENT_LIFECYCLE_TYPE", "com.redhat.console.export-service.export")
+		options.SetDefault("KAFKA_EVENT_LIFECYCLE_DATASCHEMA", "https://console.redhat.com/api/schemas/apps/export-service/v1/export-lifecycle.json")
 
 		options.SetDefault("AWS_UPLOADER_BUFFER_SIZE", 10*1024*1024)
 		options.SetDefault("AWS_DOWNLOADER_BUFFER_SIZE", 10*1024*1024)
-
-		// Rate limit defaults
-		options.SetDefault("RATE_LIMIT_RATE", 100)
-		options.SetDefault("RATE_LIMIT_BURST", 60)
+		options.SetDefault("AWS_DOWNLOAD_CONCURRENCY", 8)
+		options.SetDefault("PRESIGNED_URL_EXPIRY", 5*time.Minute)
+
+		// Archive compression levels
+		options.SetDefault("ARCHIVE_ZIP_LEVEL", 6)
+		options.SetDefault("ARCHIVE_GZIP_LEVEL", 6)
+		options.SetDefault("ARCHIVE_ZSTD_LEVEL", 3)
+
+		// Rate limit defaults, per user
+		options.SetDefault("RATE_LIMIT_CREATE_RATE", 1)
+		options.SetDefault("RATE_LIMIT_CREATE_BURST", 10)
+		options.SetDefault("RATE_LIMIT_LIST_RATE", 10)
+		options.SetDefault("RATE_LIMIT_LIST_BURST", 50)
+		options.SetDefault("RATE_LIMIT_DOWNLOAD_RATE", 2)
+		options.SetDefault("RATE_LIMIT_DOWNLOAD_BURST", 20)
+
+		// Webhook defaults
+		options.SetDefault("WEBHOOK_TIMEOUT", 10*time.Second)
+		options.SetDefault("WEBHOOK_MAX_ATTEMPTS", 5)
+		options.SetDefault("WEBHOOK_BACKOFF", 30*time.Second)
+		options.SetDefault("WEBHOOK_MAX_BACKOFF", 10*time.Minute)
 
 		options.AutomaticEnv()
 
@@ -163,6 +337,8 @@ func Get() *ExportConfig {
 		kubenv.AutomaticEnv()
 
 		psks, pskMap := parsePSKs(os.Getenv("EXPORTS_PSKS"))
+		retryPolicies := parseRetryPolicies(os.Getenv("EXPORT_RETRY_POLICIES"))
+		exportableResources := parseExportableResources(options.GetString("EXPORT_ENABLE_APPS"))
 
 		config = &ExportConfig{
 			Hostname:                      kubenv.GetString("Hostname"),
@@ -180,8 +356,17 @@ func Get() *ExportConfig {
 			Psks:                          psks,
 			PskMap:                        pskMap,
 			ExportExpiryDays:              options.GetInt("EXPORT_EXPIRY_DAYS"),
-			ExportableApplications:        convertExportableAppsFromConfigToInternal(options.GetStringMapStringSlice("EXPORT_ENABLE_APPS")),
+			ExportMaxExpiryDays:           options.GetInt("EXPORT_MAX_EXPIRY_DAYS"),
+			ExportableResources:           exportableResources,
+			ExportableApplications:        exportableApplicationSet(exportableResources),
 			MaxPayloadSize:                options.GetInt("MAX_PAYLOAD_SIZE"),
+			RetryPolicies:                 retryPolicies,
+			SchedulerInterval:             options.GetDuration("SCHEDULER_INTERVAL"),
+			RetryLease:                    options.GetDuration("EXPORT_RETRY_LEASE"),
+			ScheduleIdentityTTL:           options.GetDuration("SCHEDULE_IDENTITY_TTL"),
+			IdempotencyWindow:             options.GetDuration("EXPORT_IDEMPOTENCY_WINDOW"),
+			EventsHeartbeatInterval:       options.GetDuration("EVENTS_HEARTBEAT_INTERVAL"),
+			ExportExpiringNotice:          options.GetDuration("EXPORT_EXPIRING_NOTICE"),
 			DisableServiceToServicePSKAuth: options.GetBool("DISABLE_SERVICE_TO_SERVICE_PSK_AUTH"),
 		}
 
@@ -207,6 +392,18 @@ func Get() *ExportConfig {
 			UseSSL:                  options.GetBool("MINIO_SSL"),
 			AwsUploaderBufferSize:   options.GetInt64("AWS_UPLOADER_BUFFER_SIZE"),
 			AwsDownloaderBufferSize: options.GetInt64("AWS_DOWNLOADER_BUFFER_SIZE"),
+			DownloadConcurrency:     options.GetInt("AWS_DOWNLOAD_CONCURRENCY"),
+			PresignedURLExpiry:      options.GetDuration("PRESIGNED_URL_EXPIRY"),
+		}
+
+		config.ArchiveConfig = archiveConfig{
+			ZipLevel:  compressionLevel("ARCHIVE_ZIP_LEVEL", options.GetInt("ARCHIVE_ZIP_LEVEL"), 0, 9, 6),
+			GzipLevel: compressionLevel("ARCHIVE_GZIP_LEVEL", options.GetInt("ARCHIVE_GZIP_LEVEL"), 0, 9, 6),
+			ZstdLevel: compressionLevel("ARCHIVE_ZSTD_LEVEL", options.GetInt("ARCHIVE_ZSTD_LEVEL"), 1, 22, 3),
+			// the signing key is parsed from ARCHIVE_SIGNING_KEY env var
+			SigningKey: parseSigningKey(os.Getenv("ARCHIVE_SIGNING_KEY")),
+			// the password key is parsed from ARCHIVE_PASSWORD_KEY env var
+			PasswordKey: parsePasswordKey(os.Getenv("ARCHIVE_PASSWORD_KEY")),
 		}
 
 		config.KafkaConfig = kafkaConfig{
@@ -218,13 +415,51 @@ func Get() *ExportConfig {
 			EventType:        options.GetString("KAFKA_EVENT_TYPE"),
 			EventDataSchema:  options.GetString("KAFKA_EVENT_DATASCHEMA"),
 			EventSchema:      options.GetString("KAFKA_EVENT_SCHEMA"),
+
+			EventCancelType:       options.GetString("KAFKA_EVENT_CANCEL_TYPE"),
+			EventCancelDataSchema: options.GetString("KAFKA_EVENT_CANCEL_DATASCHEMA"),
+
+			LifecycleTopic:           options.GetString("KAFKA_LIFECYCLE_TOPIC"),
+			EventLifecycleType:       options.GetString("KAFKA_EVENT_LIFECYCLE_TYPE"),
+			EventLifecycleDataSchema: options.GetString("KAFKA_EVENT_LIFECYCLE_DATASCHEMA"),
 		}
 
 		config.RateLimitConfig = rateLimitConfig{
-			Rate:  options.GetInt("RATE_LIMIT_RATE"),
-			Burst: options.GetInt("RATE_LIMIT_BURST"),
+			Create: RateLimit{
+				Rate:  options.GetFloat64("RATE_LIMIT_CREATE_RATE"),
+				Burst: options.GetInt("RATE_LIMIT_CREATE_BURST"),
+			},
+			List: RateLimit{
+				Rate:  options.GetFloat64("RATE_LIMIT_LIST_RATE"),
+				Burst: options.GetInt("RATE_LIMIT_LIST_BURST"),
+			},
+			Download: RateLimit{
+				Rate:  options.GetFloat64("RATE_LIMIT_DOWNLOAD_RATE"),
+				Burst: options.GetInt("RATE_LIMIT_DOWNLOAD_BURST"),
+			},
+		}
+
+		config.WebhookConfig = webhookConfig{
+			Timeout:      options.GetDuration("WEBHOOK_TIMEOUT"),
+			AllowedHosts: parseHosts(os.Getenv("WEBHOOK_ALLOWED_HOSTS")),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: options.GetInt("WEBHOOK_MAX_ATTEMPTS"),
+				Backoff:     options.GetDuration("WEBHOOK_BACKOFF"),
+				MaxBackoff:  options.GetDuration("WEBHOOK_MAX_BACKOFF"),
+			},
 		}
 
+		if len(config.WebhookConfig.AllowedHosts) == 0 {
+			fmt.Println("WARNING: WEBHOOK_ALLOWED_HOSTS is not set, callbacks can be sent to any public host")
+		}
+
+		config.Quota = Quota{
+			MaxInFlight:    options.GetInt64("EXPORT_QUOTA_MAX_IN_FLIGHT"),
+			MaxDaily:       options.GetInt64("EXPORT_QUOTA_MAX_DAILY"),
+			MaxStoredBytes: options.GetInt64("EXPORT_QUOTA_MAX_STORED_BYTES"),
+		}
+		config.QuotaOverrides = parseQuotaOverrides(os.Getenv("EXPORT_QUOTA_OVERRIDES"), config.Quota)
+
 		if clowder.IsClowderEnabled() {
 			cfg := clowder.LoadedConfig
 
@@ -253,6 +488,10 @@ func Get() *ExportConfig {
 			if config.KafkaConfig.ExportsTopic == "" {
 				fmt.Println("WARNING: Export requests kafka topic is not set within Clowder!")
 			}
+			config.KafkaConfig.LifecycleTopic = clowder.KafkaTopics[LifecycleTopic].Name
+			if config.KafkaConfig.LifecycleTopic == "" {
+				fmt.Println("WARNING: Export lifecycle kafka topic is not set within Clowder, lifecycle events are not published!")
+			}
 
 			config.KafkaConfig.SSLConfig = kafkaSSLConfig{}
 
@@ -350,15 +589,247 @@ func parsePSKs(raw string) (psks []string, pskMap map[string]string) {
 	return psks, make(map[string]string)
 }
 
-func convertExportableAppsFromConfigToInternal(config map[string][]string) map[string]map[string]bool {
-	exportableApps := make(map[string]map[string]bool)
+// parseRetryPolicies parses the EXPORT_RETRY_POLICIES value, a JSON object of
+// retry policies keyed by application, e.g.
+//
+//	{"exampleApp": {"max_attempts": 3, "backoff": "30s", "max_backoff": "5m", "error_codes": [500, 503]}}
+//
+// Invalid policies are skipped, so that their application is never retried.
+func parseRetryPolicies(raw string) map[string]RetryPolicy {
+	policies := make(map[string]RetryPolicy)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return policies
+	}
+
+	var rawPolicies map[string]struct {
+		MaxAttempts int    `json:"max_attempts"`
+		Backoff     string `json:"backoff"`
+		MaxBackoff  string `json:"max_backoff"`
+		ErrorCodes  []int  `json:"error_codes"`
+	}
+	if err := json.Unmarshal([]byte(raw), &rawPolicies); err != nil {
+		fmt.Printf("WARNING: EXPORT_RETRY_POLICIES failed to parse: %v — automatic retries are disabled\n", err)
+		return policies
+	}
+
+	for app, rp := range rawPolicies {
+		policy := RetryPolicy{
+			MaxAttempts: rp.MaxAttempts,
+			Backoff:     30 * time.Second,
+			MaxBackoff:  15 * time.Minute,
+			ErrorCodes:  rp.ErrorCodes,
+		}
 
-	for app, resources := range config {
-		if _, ok := exportableApps[app]; !ok {
-			exportableApps[app] = make(map[string]bool)
+		var err error
+		if rp.Backoff != "" {
+			if policy.Backoff, err = time.ParseDuration(rp.Backoff); err != nil || policy.Backoff <= 0 {
+				fmt.Printf("WARNING: EXPORT_RETRY_POLICIES has an invalid backoff for %s: %q\n", app, rp.Backoff)
+				continue
+			}
+		}
+		if rp.MaxBackoff != "" {
+			if policy.MaxBackoff, err = time.ParseDuration(rp.MaxBackoff); err != nil || policy.MaxBackoff <= 0 {
+				fmt.Printf("WARNING: EXPORT_RETRY_POLICIES has an invalid max_backoff for %s: %q\n", app, rp.MaxBackoff)
+				continue
+			}
+		}
+		if policy.MaxBackoff < policy.Backoff {
+			policy.MaxBackoff = policy.Backoff
 		}
+		if policy.MaxAttempts < 2 {
+			fmt.Printf("WARNING: EXPORT_RETRY_POLICIES max_attempts for %s must be at least 2\n", app)
+			continue
+		}
+
+		policies[app] = policy
+	}
+	return policies
+}
+
+// parseQuotaOverrides parses the JSON value of EXPORT_QUOTA_OVERRIDES, which
+// maps organization IDs to their quota, e.g.
+//
+//	{"12345": {"max_in_flight": 50, "max_stored_bytes": 0}}
+//
+// Limits which are left out keep their default value. Organizations with a
+// negative limit are skipped.
+func parseQuotaOverrides(raw string, defaults Quota) map[string]Quota {
+	overrides := make(map[string]Quota)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return overrides
+	}
+
+	var rawOverrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &rawOverrides); err != nil {
+		fmt.Printf("WARNING: EXPORT_QUOTA_OVERRIDES failed to parse: %v — the default quota applies to every organization\n", err)
+		return overrides
+	}
+
+	for orgID, rawQuota := range rawOverrides {
+		quota := defaults
+		if err := json.Unmarshal(rawQuota, &quota); err != nil {
+			fmt.Printf("WARNING: EXPORT_QUOTA_OVERRIDES has an invalid quota for %s: %v\n", orgID, err)
+			continue
+		}
+		if quota.MaxInFlight < 0 || quota.MaxDaily < 0 || quota.MaxStoredBytes < 0 {
+			fmt.Printf("WARNING: EXPORT_QUOTA_OVERRIDES has a negative limit for %s\n", orgID)
+			continue
+		}
+		overrides[orgID] = quota
+	}
+	return overrides
+}
+
+// compressionLevel returns level if it is between lowest and highest, and
+// fallback otherwise.
+func compressionLevel(name string, level, lowest, highest, fallback int) int {
+	if level < lowest || level > highest {
+		fmt.Printf("WARNING: %s must be between %d and %d, using %d\n", name, lowest, highest, fallback)
+		return fallback
+	}
+	return level
+}
+
+// parseSigningKey parses the ARCHIVE_SIGNING_KEY value, the base64 encoded
+// seed of an ed25519 key. It returns nil, and archives are not signed, if the
+// value is empty or invalid.
+func parseSigningKey(raw string) ed25519.PrivateKey {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		fmt.Printf("WARNING: ARCHIVE_SIGNING_KEY must be the base64 encoded %d byte seed of an ed25519 key, archives are not signed\n", ed25519.SeedSize)
+		return nil
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// parsePasswordKey parses the ARCHIVE_PASSWORD_KEY value, a base64 encoded
+// 32 byte AES-256 key. It returns nil, and exports can not be encrypted with a
+// password, if the value is empty or invalid.
+func parsePasswordKey(raw string) []byte {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		fmt.Println("WARNING: ARCHIVE_PASSWORD_KEY must be a base64 encoded 32 byte key, exports can not be encrypted with a password")
+		return nil
+	}
+	return key
+}
+
+// parseHosts parses a comma-separated list of host names, such as the
+// WEBHOOK_ALLOWED_HOSTS value. Host names are compared case-insensitively.
+func parseHosts(raw string) []string {
+	var hosts []string
+	for _, host := range strings.Split(raw, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// parseExportableResources parses the JSON value of EXPORT_ENABLE_APPS, which
+// maps every application to its resources. The resources of an application are
+// either a list of names, or an object with the configuration of each of them:
+//
+//	{
+//		"exampleApp": ["exampleResource", "anotherExampleResource"],
+//		"otherApp": {
+//			"otherResource": {
+//				"description": "Other data",
+//				"formats": ["json", "xlsx"],
+//				"native_formats": ["json"],
+//				"expiry_days": 3,
+//				"filter_schema": {"type": "object"}
+//			}
+//		}
+//	}
+//
+// Resources with an invalid configuration are skipped.
+func parseExportableResources(raw string) map[string]map[string]ExportableResource {
+	exportableResources := make(map[string]map[string]ExportableResource)
+
+	var apps map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &apps); err != nil {
+		fmt.Printf("WARNING: EXPORT_ENABLE_APPS failed to parse: %v — no application can be exported\n", err)
+		return exportableResources
+	}
+
+	for app, rawResources := range apps {
+		resources := make(map[string]ExportableResource)
+
+		var names []string
+		if err := json.Unmarshal(rawResources, &names); err == nil {
+			for _, name := range names {
+				resources[name] = ExportableResource{}
+			}
+			exportableResources[app] = resources
+			continue
+		}
+
+		var configured map[string]ExportableResource
+		if err := json.Unmarshal(rawResources, &configured); err != nil {
+			fmt.Printf("WARNING: EXPORT_ENABLE_APPS has invalid resources for %s: %v\n", app, err)
+			continue
+		}
+		for name, resource := range configured {
+			if resource.ExpiryDays < 0 {
+				fmt.Printf("WARNING: EXPORT_ENABLE_APPS has a negative expiry_days for %s/%s\n", app, name)
+				continue
+			}
+			if len(resource.NativeFormats) > 0 && !slices.Contains(resource.NativeFormats, "json") && !slices.Contains(resource.NativeFormats, "csv") {
+				fmt.Printf("WARNING: EXPORT_ENABLE_APPS native_formats for %s/%s has to include json or csv\n", app, name)
+				continue
+			}
+			if len(resource.FilterSchema) > 0 {
+				schema, err := compileFilterSchema(app+"/"+name, resource.FilterSchema)
+				if err != nil {
+					fmt.Printf("WARNING: EXPORT_ENABLE_APPS has an invalid filter_schema for %s/%s: %v\n", app, name, err)
+					continue
+				}
+				resource.Schema = schema
+			}
+			resources[name] = resource
+		}
+		exportableResources[app] = resources
+	}
+
+	return exportableResources
+}
+
+// compileFilterSchema compiles the filter schema of the resource with the given
+// name. Schemas can only reference themselves, nothing is loaded from outside.
+func compileFilterSchema(name string, raw json.RawMessage) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	url := "urn:export-service:filters:" + name
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// exportableApplicationSet returns the names of the exportable resources of
+// every application.
+func exportableApplicationSet(exportableResources map[string]map[string]ExportableResource) map[string]map[string]bool {
+	exportableApps := make(map[string]map[string]bool)
 
-		for _, resource := range resources {
+	for app, resources := range exportableResources {
+		exportableApps[app] = make(map[string]bool)
+		for resource := range resources {
 			exportableApps[app][resource] = true
 		}
 	}
@@ -1,7 +1,13 @@
 package config
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestParsePSKs(t *testing.T) {
@@ -101,3 +107,308 @@ func TestParsePSKs(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]RetryPolicy
+	}{
+		{
+			name:  "empty string",
+			input: "",
+			want:  map[string]RetryPolicy{},
+		},
+		{
+			name:  "invalid JSON",
+			input: `{invalid-json`,
+			want:  map[string]RetryPolicy{},
+		},
+		{
+			name:  "full policy",
+			input: `{"exampleApp": {"max_attempts": 3, "backoff": "10s", "max_backoff": "1m", "error_codes": [500, 503]}}`,
+			want: map[string]RetryPolicy{
+				"exampleApp": {MaxAttempts: 3, Backoff: 10 * time.Second, MaxBackoff: time.Minute, ErrorCodes: []int{500, 503}},
+			},
+		},
+		{
+			name:  "defaults",
+			input: `{"exampleApp": {"max_attempts": 2}}`,
+			want: map[string]RetryPolicy{
+				"exampleApp": {MaxAttempts: 2, Backoff: 30 * time.Second, MaxBackoff: 15 * time.Minute},
+			},
+		},
+		{
+			name:  "max_backoff is raised to backoff",
+			input: `{"exampleApp": {"max_attempts": 2, "backoff": "1h"}}`,
+			want: map[string]RetryPolicy{
+				"exampleApp": {MaxAttempts: 2, Backoff: time.Hour, MaxBackoff: time.Hour},
+			},
+		},
+		{
+			name:  "invalid policies are skipped",
+			input: `{"once": {"max_attempts": 1}, "badBackoff": {"max_attempts": 3, "backoff": "soon"}, "ok": {"max_attempts": 4}}`,
+			want: map[string]RetryPolicy{
+				"ok": {MaxAttempts: 4, Backoff: 30 * time.Second, MaxBackoff: 15 * time.Minute},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryPolicies(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRetryPolicies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second, ErrorCodes: []int{503}}
+
+	retries := []struct {
+		code, attempts int
+		want           bool
+	}{
+		{code: 503, attempts: 1, want: true},
+		{code: 503, attempts: 2, want: true},
+		{code: 503, attempts: 3, want: false},
+		{code: 400, attempts: 1, want: false},
+	}
+	for _, tt := range retries {
+		if got := policy.Retries(tt.code, tt.attempts); got != tt.want {
+			t.Errorf("Retries(%d, %d) = %v, want %v", tt.code, tt.attempts, got, tt.want)
+		}
+	}
+
+	policy.ErrorCodes = nil
+	if !policy.Retries(400, 1) {
+		t.Errorf("Retries(400, 1) = false, want true for a policy without error codes")
+	}
+
+	delays := map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 3 * time.Second,
+		9: 3 * time.Second,
+	}
+	for attempts, want := range delays {
+		if got := policy.Delay(attempts); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "empty string", input: "", want: nil},
+		{name: "single host", input: "example.com", want: []string{"example.com"}},
+		{name: "whitespace and case", input: " Example.com , hooks.example.org ", want: []string{"example.com", "hooks.example.org"}},
+		{name: "empty entries are skipped", input: "a.example.com,,b.example.com,", want: []string{"a.example.com", "b.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHosts(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuotaOverrides(t *testing.T) {
+	defaults := Quota{MaxInFlight: 10, MaxDaily: 100, MaxStoredBytes: 1 << 30}
+
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]Quota
+	}{
+		{name: "empty string", input: "", want: map[string]Quota{}},
+		{name: "invalid JSON", input: "{not json", want: map[string]Quota{}},
+		{
+			name:  "missing limits keep their default",
+			input: `{"12345": {"max_in_flight": 50}}`,
+			want:  map[string]Quota{"12345": {MaxInFlight: 50, MaxDaily: 100, MaxStoredBytes: 1 << 30}},
+		},
+		{
+			name:  "zero removes a limit",
+			input: `{"12345": {"max_daily": 0, "max_stored_bytes": 0}}`,
+			want:  map[string]Quota{"12345": {MaxInFlight: 10}},
+		},
+		{
+			name:  "invalid organizations are skipped",
+			input: `{"12345": {"max_daily": -1}, "67890": {"max_daily": "many"}, "11111": {"max_daily": 5}}`,
+			want:  map[string]Quota{"11111": {MaxInFlight: 10, MaxDaily: 5, MaxStoredBytes: 1 << 30}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseQuotaOverrides(tt.input, defaults)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQuotaOverrides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaFor(t *testing.T) {
+	cfg := &ExportConfig{
+		Quota:          Quota{MaxInFlight: 10},
+		QuotaOverrides: map[string]Quota{"12345": {MaxInFlight: 50}},
+	}
+
+	if got := cfg.QuotaFor("12345"); got.MaxInFlight != 50 {
+		t.Errorf("QuotaFor(overridden) = %v, want the override", got)
+	}
+	if got := cfg.QuotaFor("67890"); got.MaxInFlight != 10 {
+		t.Errorf("QuotaFor(other) = %v, want the default", got)
+	}
+}
+
+func TestParseExportableResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       map[string][]string
+		withSchema []string
+	}{
+		{name: "invalid JSON", input: "{not json", want: map[string][]string{}},
+		{
+			name:  "lists of resources",
+			input: `{"exampleApp": ["exampleResource", "anotherExampleResource"]}`,
+			want:  map[string][]string{"exampleApp": {"anotherExampleResource", "exampleResource"}},
+		},
+		{
+			name:       "configured resources",
+			input:      `{"exampleApp": ["exampleResource"], "otherApp": {"withSchema": {"filter_schema": {"type": "object"}}, "withoutSchema": {}}}`,
+			want:       map[string][]string{"exampleApp": {"exampleResource"}, "otherApp": {"withSchema", "withoutSchema"}},
+			withSchema: []string{"otherApp/withSchema"},
+		},
+		{
+			name:  "resources with an invalid schema are skipped",
+			input: `{"otherApp": {"invalid": {"filter_schema": {"type": 5}}, "valid": {}}}`,
+			want:  map[string][]string{"otherApp": {"valid"}},
+		},
+		{
+			name:  "resources with a negative expiry are skipped",
+			input: `{"otherApp": {"invalid": {"expiry_days": -1}, "valid": {"expiry_days": 3}}}`,
+			want:  map[string][]string{"otherApp": {"valid"}},
+		},
+		{
+			name:  "resources which natively produce neither json nor csv are skipped",
+			input: `{"otherApp": {"invalid": {"native_formats": ["xlsx"]}, "valid": {"native_formats": ["csv", "xlsx"]}}}`,
+			want:  map[string][]string{"otherApp": {"valid"}},
+		},
+		{
+			name:  "applications with invalid resources are skipped",
+			input: `{"exampleApp": "exampleResource", "otherApp": ["otherResource"]}`,
+			want:  map[string][]string{"otherApp": {"otherResource"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseExportableResources(tt.input)
+
+			names := make(map[string][]string)
+			var withSchema []string
+			for app, resources := range got {
+				names[app] = []string{}
+				for name, resource := range resources {
+					names[app] = append(names[app], name)
+					if resource.Schema != nil {
+						withSchema = append(withSchema, app+"/"+name)
+					}
+				}
+				slices.Sort(names[app])
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("parseExportableResources() resources = %v, want %v", names, tt.want)
+			}
+			if !reflect.DeepEqual(withSchema, tt.withSchema) {
+				t.Errorf("parseExportableResources() schemas = %v, want %v", withSchema, tt.withSchema)
+			}
+		})
+	}
+}
+
+func TestParseExportableResourcesConfiguration(t *testing.T) {
+	got := parseExportableResources(`{"otherApp": {"otherResource": {"description": "Other data", "formats": ["json"], "expiry_days": 3}}}`)
+
+	resource := got["otherApp"]["otherResource"]
+	if resource.Description != "Other data" || !reflect.DeepEqual(resource.Formats, []string{"json"}) || resource.ExpiryDays != 3 {
+		t.Errorf("parseExportableResources() resource = %+v", resource)
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+		want  int
+	}{
+		{name: "within range", level: 9, want: 9},
+		{name: "lowest level", level: 1, want: 1},
+		{name: "too low", level: 0, want: 3},
+		{name: "too high", level: 23, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compressionLevel("ARCHIVE_ZSTD_LEVEL", tt.level, 1, 22, 3); got != tt.want {
+				t.Errorf("compressionLevel() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, ed25519.SeedSize)
+
+	tests := []struct {
+		name  string
+		input string
+		want  ed25519.PrivateKey
+	}{
+		{name: "empty string", input: "", want: nil},
+		{name: "seed", input: base64.StdEncoding.EncodeToString(seed), want: ed25519.NewKeyFromSeed(seed)},
+		{name: "invalid base64", input: "not base64!", want: nil},
+		{name: "wrong length", input: base64.StdEncoding.EncodeToString(seed[:16]), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSigningKey(tt.input); !bytes.Equal(got, tt.want) {
+				t.Errorf("parseSigningKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePasswordKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []byte
+	}{
+		{name: "empty string", input: "", want: nil},
+		{name: "key", input: base64.StdEncoding.EncodeToString(key), want: key},
+		{name: "invalid base64", input: "not base64!", want: nil},
+		{name: "wrong length", input: base64.StdEncoding.EncodeToString(key[:16]), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePasswordKey(tt.input); !bytes.Equal(got, tt.want) {
+				t.Errorf("parsePasswordKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
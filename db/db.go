@@ -7,7 +7,10 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/lib/pq"
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
@@ -41,3 +44,13 @@ func buildPostgresDSN(cfg config.ExportConfig) string {
 
 	return dsn
 }
+
+// NewListener returns a listener for Postgres notifications. The listener
+// reconnects on its own whenever the connection is lost.
+func NewListener(cfg config.ExportConfig, log *zap.SugaredLogger) *pq.Listener {
+	return pq.NewListener(buildPostgresDSN(cfg), 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warnw("postgres listener connection problem", "event", event, "error", err)
+		}
+	})
+}
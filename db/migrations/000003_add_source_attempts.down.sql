@@ -0,0 +1,2 @@
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS identity;
+ALTER TABLE sources DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS attempts int NOT NULL DEFAULT 1;
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS identity text;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS export_definitions (
+    id uuid PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    name text NOT NULL,
+    format text NOT NULL,
+    sources jsonb NOT NULL,
+    account_id text,
+    organization_id text,
+    username text
+);
+
+CREATE INDEX IF NOT EXISTS export_definitions_account_id_org_id_username_index ON export_definitions (account_id, organization_id, username);
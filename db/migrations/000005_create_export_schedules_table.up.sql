@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS export_schedules (
+    id uuid PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    definition_id uuid NOT NULL REFERENCES export_definitions (id) ON DELETE CASCADE,
+    cron text NOT NULL,
+    enabled boolean NOT NULL DEFAULT true,
+    next_run_at timestamp with time zone,
+    last_run_at timestamp with time zone,
+    last_export_id uuid,
+    identity text,
+    account_id text,
+    organization_id text,
+    username text
+);
+
+CREATE INDEX IF NOT EXISTS export_schedules_next_run_at_index ON export_schedules (next_run_at) WHERE enabled;
+CREATE INDEX IF NOT EXISTS export_schedules_account_id_org_id_username_index ON export_schedules (account_id, organization_id, username);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS export_payloads_idempotency_key_index;
+
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS request_hash;
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS idempotency_key;
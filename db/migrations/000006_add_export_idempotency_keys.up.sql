@@ -0,0 +1,4 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS idempotency_key text NOT NULL DEFAULT '';
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS request_hash text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS export_payloads_idempotency_key_index ON export_payloads (account_id, organization_id, username, idempotency_key) WHERE idempotency_key <> '';
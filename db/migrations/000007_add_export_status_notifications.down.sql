@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS sources_status_changed ON sources;
+DROP TRIGGER IF EXISTS export_payloads_status_changed ON export_payloads;
+DROP TRIGGER IF EXISTS export_payloads_status_created ON export_payloads;
+
+DROP FUNCTION IF EXISTS notify_source_status();
+DROP FUNCTION IF EXISTS notify_export_status();
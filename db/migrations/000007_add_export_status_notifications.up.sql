@@ -0,0 +1,44 @@
+CREATE OR REPLACE FUNCTION notify_export_status() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('export_status', json_build_object(
+        'type', 'export',
+        'export_id', NEW.id,
+        'status', NEW.status,
+        'account_id', NEW.account_id,
+        'organization_id', NEW.organization_id,
+        'username', NEW.username
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_source_status() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('export_status', json_build_object(
+        'type', 'source',
+        'export_id', NEW.export_payload_id,
+        'source_id', NEW.id,
+        'status', NEW.status,
+        'account_id', p.account_id,
+        'organization_id', p.organization_id,
+        'username', p.username
+    )::text)
+    FROM export_payloads p
+    WHERE p.id = NEW.export_payload_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER export_payloads_status_created
+    AFTER INSERT ON export_payloads
+    FOR EACH ROW EXECUTE FUNCTION notify_export_status();
+
+CREATE TRIGGER export_payloads_status_changed
+    AFTER UPDATE OF status ON export_payloads
+    FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION notify_export_status();
+
+CREATE TRIGGER sources_status_changed
+    AFTER UPDATE OF status ON sources
+    FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION notify_source_status();
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS callback_secret;
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS callback_url;
@@ -0,0 +1,17 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS callback_url text NOT NULL DEFAULT '';
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS callback_secret text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id uuid PRIMARY KEY,
+    created_at timestamp with time zone,
+    export_payload_id uuid NOT NULL REFERENCES export_payloads (id) ON DELETE CASCADE,
+    delivery_id uuid NOT NULL,
+    url text NOT NULL,
+    status text NOT NULL,
+    attempt integer NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    delivered boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_export_payload_id_index ON webhook_deliveries (export_payload_id);
@@ -0,0 +1 @@
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS expiry_notified_at;
@@ -0,0 +1 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS expiry_notified_at timestamp with time zone;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS export_payloads_org_id_created_at_index;
+
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS archive_size;
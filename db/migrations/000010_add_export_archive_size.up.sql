@@ -0,0 +1,3 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS archive_size bigint NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS export_payloads_org_id_created_at_index ON export_payloads (organization_id, created_at);
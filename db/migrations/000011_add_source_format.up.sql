@@ -0,0 +1,3 @@
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS format text;
+
+UPDATE sources SET format = export_payloads.format FROM export_payloads WHERE sources.export_payload_id = export_payloads.id AND sources.format IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS archive text NOT NULL DEFAULT 'zip';
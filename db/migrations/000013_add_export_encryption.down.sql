@@ -0,0 +1,2 @@
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS encryption_key;
+ALTER TABLE export_payloads DROP COLUMN IF EXISTS encryption_type;
@@ -0,0 +1,2 @@
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS encryption_type text;
+ALTER TABLE export_payloads ADD COLUMN IF NOT EXISTS encryption_key text;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS sources_next_attempt_at_index;
+ALTER TABLE sources DROP COLUMN IF EXISTS next_attempt_at;
@@ -0,0 +1,2 @@
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS next_attempt_at timestamp with time zone;
+CREATE INDEX IF NOT EXISTS sources_next_attempt_at_index ON sources (next_attempt_at) WHERE next_attempt_at IS NOT NULL;
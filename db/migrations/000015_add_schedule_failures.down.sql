@@ -0,0 +1,2 @@
+ALTER TABLE export_schedules DROP COLUMN IF EXISTS last_error;
+ALTER TABLE export_schedules DROP COLUMN IF EXISTS failures;
@@ -0,0 +1,2 @@
+ALTER TABLE export_schedules ADD COLUMN IF NOT EXISTS failures int NOT NULL DEFAULT 0;
+ALTER TABLE export_schedules ADD COLUMN IF NOT EXISTS last_error text;
@@ -0,0 +1 @@
+-- the identities of finished exports are not restored
@@ -0,0 +1 @@
+UPDATE export_payloads SET identity = '' WHERE status NOT IN ('pending', 'running') AND identity <> '';
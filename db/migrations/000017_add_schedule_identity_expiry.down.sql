@@ -0,0 +1 @@
+ALTER TABLE export_schedules DROP COLUMN IF EXISTS identity_expires_at;
@@ -0,0 +1,4 @@
+ALTER TABLE export_schedules ADD COLUMN IF NOT EXISTS identity_expires_at timestamp with time zone;
+-- existing schedules have to be updated within 30 days to keep running
+UPDATE export_schedules SET identity_expires_at = now() + interval '30 days' WHERE identity_expires_at IS NULL;
+ALTER TABLE export_schedules ALTER COLUMN identity_expires_at SET NOT NULL;
@@ -0,0 +1,183 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// Channel is the Postgres notification channel that the database triggers
+// publish every status change of an export or of one of its sources to.
+const Channel = "export_status"
+
+// The types of StatusEvent.
+const (
+	ExportEvent = "export"
+	SourceEvent = "source"
+)
+
+// subscriptionBuffer is the number of events a subscriber may fall behind by
+// before it is disconnected.
+const subscriptionBuffer = 32
+
+// StatusEvent is a change of the status of an export, or of one of its sources.
+type StatusEvent struct {
+	Type     string      `json:"type"`
+	ExportID uuid.UUID   `json:"export_id"`
+	SourceID *uuid.UUID  `json:"source_id,omitempty"`
+	Status   string      `json:"status"`
+	User     models.User `json:"-"`
+}
+
+// notification is the payload of a notification on Channel.
+type notification struct {
+	StatusEvent
+	AccountID      string `json:"account_id"`
+	OrganizationID string `json:"organization_id"`
+	Username       string `json:"username"`
+}
+
+// Subscription receives the status events of a single export, or of every
+// export of a user. C is closed when the subscription ends, including when the
+// subscriber falls too far behind.
+type Subscription struct {
+	C        <-chan StatusEvent
+	c        chan StatusEvent
+	user     models.User
+	exportID uuid.UUID
+}
+
+func (s *Subscription) matches(event StatusEvent) bool {
+	return event.User == s.user && (s.exportID == uuid.Nil || s.exportID == event.ExportID)
+}
+
+// Broker fans the status events received from Postgres out to its subscribers.
+// Every replica runs its own broker, so events reach clients regardless of the
+// replica which made the change.
+type Broker struct {
+	Log *zap.SugaredLogger
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func NewBroker(log *zap.SugaredLogger) *Broker {
+	return &Broker{Log: log, subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription to the status events of the export with the
+// given ID, or to those of every export of user if exportID is uuid.Nil.
+func (b *Broker) Subscribe(user models.User, exportID uuid.UUID) *Subscription {
+	c := make(chan StatusEvent, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, user: user, exportID: exportID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return s
+	}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe ends the subscription. It is safe to call more than once.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+// Close ends every subscription, and any made afterwards, so that the
+// streams of the subscribers finish when the server shuts down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		b.remove(s)
+	}
+}
+
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Publish sends event to every matching subscriber. A subscriber whose buffer
+// is full is disconnected rather than blocking everyone else; it can
+// resubscribe and fetch the current status again.
+func (b *Broker) Publish(event StatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if !s.matches(event) {
+			continue
+		}
+		select {
+		case s.c <- event:
+		default:
+			b.Log.Warnw("disconnecting slow status event subscriber", "export_id", s.exportID)
+			b.remove(s)
+		}
+	}
+}
+
+// Listen publishes the notifications received by listener until ctx is
+// cancelled, and then closes the listener.
+func (b *Broker) Listen(ctx context.Context, listener *pq.Listener) error {
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				// the connection was re-established, notifications sent in
+				// the meantime are lost
+				b.Log.Info("reconnected to the status event channel")
+				continue
+			}
+
+			var payload notification
+			if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+				b.Log.Errorw("failed to parse status event", "error", err)
+				continue
+			}
+			event := payload.StatusEvent
+			event.User = models.User{
+				AccountID:      payload.AccountID,
+				OrganizationID: payload.OrganizationID,
+				Username:       payload.Username,
+			}
+			b.Publish(event)
+		case <-time.After(90 * time.Second):
+			// make sure that a silently dropped connection is noticed
+			go func() {
+				if err := listener.Ping(); err != nil {
+					b.Log.Warnw("status event listener ping failed", "error", err)
+				}
+			}()
+		}
+	}
+}
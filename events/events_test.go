@@ -0,0 +1,83 @@
+package events_test
+
+import (
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/events"
+	"github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+var _ = Describe("Broker", func() {
+	var (
+		broker *events.Broker
+		user   models.User
+	)
+
+	BeforeEach(func() {
+		broker = events.NewBroker(logger.Get())
+		user = models.User{AccountID: "1234", OrganizationID: "5678", Username: "batman"}
+	})
+
+	statusEvent := func(user models.User, exportID uuid.UUID, status string) events.StatusEvent {
+		return events.StatusEvent{Type: events.ExportEvent, ExportID: exportID, Status: status, User: user}
+	}
+
+	It("only delivers the events of the subscribed export", func() {
+		exportID := uuid.New()
+		sub := broker.Subscribe(user, exportID)
+
+		broker.Publish(statusEvent(user, uuid.New(), "running"))
+		broker.Publish(statusEvent(user, exportID, "running"))
+
+		Expect(sub.C).To(Receive(HaveField("ExportID", exportID)))
+		Expect(sub.C).ToNot(Receive())
+	})
+
+	It("delivers the events of every export of the user", func() {
+		sub := broker.Subscribe(user, uuid.Nil)
+
+		broker.Publish(statusEvent(user, uuid.New(), "running"))
+		broker.Publish(statusEvent(user, uuid.New(), "complete"))
+
+		Expect(sub.C).To(Receive(HaveField("Status", "running")))
+		Expect(sub.C).To(Receive(HaveField("Status", "complete")))
+	})
+
+	It("does not deliver the events of other users", func() {
+		exportID := uuid.New()
+		sub := broker.Subscribe(user, uuid.Nil)
+
+		other := user
+		other.Username = "robin"
+		broker.Publish(statusEvent(other, exportID, "running"))
+
+		Expect(sub.C).ToNot(Receive())
+	})
+
+	It("disconnects subscribers that fall behind", func() {
+		exportID := uuid.New()
+		sub := broker.Subscribe(user, exportID)
+
+		for i := 0; i < 100; i++ {
+			broker.Publish(statusEvent(user, exportID, "running"))
+		}
+
+		Eventually(sub.C).Should(BeClosed())
+
+		// unsubscribing afterwards is harmless
+		broker.Unsubscribe(sub)
+	})
+
+	It("ends every subscription when it is closed", func() {
+		sub := broker.Subscribe(user, uuid.Nil)
+
+		broker.Close()
+		Expect(sub.C).To(BeClosed())
+
+		late := broker.Subscribe(user, uuid.Nil)
+		Expect(late.C).To(BeClosed())
+	})
+})
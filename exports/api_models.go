@@ -14,8 +14,24 @@ type ExportPayload struct {
 	Expires     *time.Time `json:"expires_at,omitempty"`
 	Name        string     `json:"name"`
 	Format      string     `json:"format"`
+	Archive     string     `json:"archive,omitempty"`
 	Status      string     `json:"status"`
 	Sources     []Source   `json:"sources"`
+	// CallbackURL is notified once the export is finished. The secret used
+	// to sign the notifications is never returned.
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"callback_secret,omitempty"`
+	// Encryption is how the archive is encrypted. Passwords are never
+	// returned or stored.
+	Encryption *Encryption `json:"encryption,omitempty"`
+}
+
+// Encryption is the key that the archive of an export is encrypted with: the
+// age or OpenPGP public key of the recipient, or a password for a zip.
+type Encryption struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"public_key,omitempty"`
+	Password  string `json:"password,omitempty"`
 }
 
 type Source struct {
@@ -24,6 +40,9 @@ type Source struct {
 	Status      string         `json:"status"`
 	Resource    string         `json:"resource"`
 	Filters     datatypes.JSON `json:"filters"`
+	// Format is the format that the data of the source is downloaded in, see
+	// models.Source. It is ignored in requests.
+	Format string `json:"format,omitempty"`
 	SourceError
 }
 
@@ -31,3 +50,67 @@ type SourceError struct {
 	Message string `json:"message,omitempty"`
 	Code    int    `json:"error,omitempty"`
 }
+
+// ExportUpdate is the body of a request to change an existing export. Fields
+// which are omitted are left unchanged.
+type ExportUpdate struct {
+	Name    *string    `json:"name,omitempty"`
+	Expires *time.Time `json:"expires_at,omitempty"`
+}
+
+// RetryRequest is the optional body of a retry request. When Sources is empty
+// every failed source of the export is retried.
+type RetryRequest struct {
+	Sources []uuid.UUID `json:"sources"`
+}
+
+type ExportDefinition struct {
+	ID        string             `json:"id"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Name      string             `json:"name"`
+	Format    string             `json:"format"`
+	Sources   []DefinitionSource `json:"sources"`
+}
+
+type DefinitionSource struct {
+	Application string         `json:"application"`
+	Resource    string         `json:"resource"`
+	Filters     datatypes.JSON `json:"filters,omitempty"`
+}
+
+// ScheduleRequest is the body of a request to create or replace a schedule.
+// Schedules are enabled unless Enabled is false.
+type ScheduleRequest struct {
+	DefinitionID uuid.UUID `json:"definition_id"`
+	Cron         string    `json:"cron"`
+	Enabled      *bool     `json:"enabled,omitempty"`
+}
+
+type ExportSchedule struct {
+	ID           string     `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DefinitionID string     `json:"definition_id"`
+	Cron         string     `json:"cron"`
+	Enabled      bool       `json:"enabled"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastExportID *uuid.UUID `json:"last_export_id,omitempty"`
+	// IdentityExpiresAt is when the schedule stops running until it is
+	// updated again.
+	IdentityExpiresAt time.Time `json:"identity_expires_at"`
+}
+
+// WebhookDelivery is a single attempt to notify the callback URL of an export.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	DeliveryID string    `json:"delivery_id"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+}
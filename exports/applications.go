@@ -0,0 +1,146 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
+
+	"github.com/redhatinsights/export-service-go/config"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/middleware"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// Application is an application whose resources can be exported.
+type Application struct {
+	Name      string               `json:"name"`
+	Resources []ExportableResource `json:"resources"`
+}
+
+// ExportableResource describes a resource that can be exported, and how.
+type ExportableResource struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Formats      []string        `json:"formats"`
+	FilterSchema json.RawMessage `json:"filter_schema,omitempty"`
+	ExpiryDays   int             `json:"expiry_days"`
+}
+
+// ApplicationRouter is a router for the /applications endpoint.
+func (e *Export) ApplicationRouter(r chi.Router) {
+	r.With(e.RateLimits.List.Limit).Get("/", e.ListApplications)
+}
+
+// ListApplications handles GET requests to the /applications endpoint. It
+// lists the applications and resources that can be exported.
+func (e *Export) ListApplications(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	cfg := config.Get()
+	applications := exportableApplications(cfg.ExportableResources, cfg.ExportExpiryDays)
+
+	if err := json.NewEncoder(w).Encode(&applications); err != nil {
+		logger.Errorw("error while trying to encode", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// exportableApplications converts the configured resources into the
+// applications returned by the API, sorted by name. Resources without formats
+// or expiry are listed with every format and the default expiry.
+func exportableApplications(resources map[string]map[string]config.ExportableResource, defaultExpiryDays int) []Application {
+	allFormats := make([]string, 0, len(models.PayloadFormats))
+	for _, format := range models.PayloadFormats {
+		allFormats = append(allFormats, string(format))
+	}
+
+	applications := make([]Application, 0, len(resources))
+	for app, appResources := range resources {
+		application := Application{Name: app, Resources: make([]ExportableResource, 0, len(appResources))}
+		for name, resource := range appResources {
+			exportable := ExportableResource{
+				Name:         name,
+				Description:  resource.Description,
+				Formats:      resource.Formats,
+				FilterSchema: resource.FilterSchema,
+				ExpiryDays:   resource.ExpiryDays,
+			}
+			if len(exportable.Formats) == 0 {
+				exportable.Formats = allFormats
+			}
+			if exportable.ExpiryDays == 0 {
+				exportable.ExpiryDays = defaultExpiryDays
+			}
+			application.Resources = append(application.Resources, exportable)
+		}
+		sort.Slice(application.Resources, func(i, j int) bool {
+			return application.Resources[i].Name < application.Resources[j].Name
+		})
+		applications = append(applications, application)
+	}
+	sort.Slice(applications, func(i, j int) bool { return applications[i].Name < applications[j].Name })
+	return applications
+}
+
+// verifyFormat verifies that every source can be exported in format. The
+// sources have to be verified with verifyExportableApplication first.
+func verifyFormat(resources map[string]map[string]config.ExportableResource, format models.PayloadFormat, sources []Source) error {
+	for _, source := range sources {
+		formats := resources[source.Application][source.Resource].Formats
+		if len(formats) > 0 && !slices.Contains(formats, string(format)) {
+			return fmt.Errorf("format '%s' is not supported by %s/%s", format, source.Application, source.Resource)
+		}
+	}
+	return nil
+}
+
+// sourceFormat returns the format that source is requested in from its
+// application when the export is in format: format itself if the application
+// produces it natively, otherwise json, or csv, which the source is converted
+// from when the export is compressed. PDFs are always rendered by the service.
+func sourceFormat(resources map[string]map[string]config.ExportableResource, format models.PayloadFormat, source models.Source) models.PayloadFormat {
+	nativeFormats := resources[source.Application][source.Resource].NativeFormats
+	if len(nativeFormats) == 0 {
+		nativeFormats = []string{string(models.CSV), string(models.JSON)}
+	}
+
+	switch {
+	case format != models.PDF && slices.Contains(nativeFormats, string(format)):
+		return format
+	case slices.Contains(nativeFormats, string(models.JSON)):
+		return models.JSON
+	default:
+		return models.CSV
+	}
+}
+
+// resourceExpiry returns when an export of sources expires by default: after
+// the shortest expiry_days of their resources. It returns nil if none of the
+// resources has its own expiry, so that the default of the service applies.
+func resourceExpiry(resources map[string]map[string]config.ExportableResource, sources []models.Source) *time.Time {
+	days := 0
+	for _, source := range sources {
+		expiryDays := resources[source.Application][source.Resource].ExpiryDays
+		if expiryDays > 0 && (days == 0 || expiryDays < days) {
+			days = expiryDays
+		}
+	}
+	if days == 0 {
+		return nil
+	}
+	expires := time.Now().AddDate(0, 0, days)
+	return &expires
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+
+	"github.com/redhatinsights/export-service-go/config"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/middleware"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// DefinitionRouter is a router for all of the external routes for the
+// /exports/definitions endpoint.
+func (e *Export) DefinitionRouter(r chi.Router) {
+	r.With(e.RateLimits.List.Limit).Post("/", e.PostDefinition)
+	r.With(e.RateLimits.List.Limit, middleware.PaginationCtx).Get("/", e.ListDefinitions)
+	r.Route("/{definitionUUID}", func(sub chi.Router) {
+		sub.With(e.RateLimits.Create.Limit).Post("/run", e.RunDefinition)
+		sub.Group(func(sub chi.Router) {
+			sub.Use(e.RateLimits.List.Limit)
+			sub.Get("/", e.GetDefinition)
+			sub.Put("/", e.PutDefinition)
+			sub.Delete("/", e.DeleteDefinition)
+		})
+	})
+}
+
+// PostDefinition handles POST requests to the /exports/definitions endpoint.
+func (e *Export) PostDefinition(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	definition := decodeDefinition(w, r, logger)
+	if definition == nil {
+		return
+	}
+	definition.User = mapUsertoModelUser(user)
+
+	definition, err := e.DB.CreateDefinition(definition)
+	if err != nil {
+		logger.Errorw("error creating definition entry", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Infow("export definition created successfully", "definition_id", definition.ID, "definition_name", definition.Name)
+
+	w.WriteHeader(http.StatusCreated)
+
+	apiDefinition := DBDefinitionToAPI(*definition)
+	if err := json.NewEncoder(w).Encode(&apiDefinition); err != nil {
+		logger.Errorw("error while trying to encode", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// ListDefinitions handles GET requests to the /exports/definitions endpoint.
+func (e *Export) ListDefinitions(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+	page := middleware.GetPagination(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if page.SortBy == "expires" {
+		BadRequestError(w, "definitions can only be sorted by 'name' or 'created'")
+		return
+	}
+
+	definitions, count, err := e.DB.ListDefinitions(mapUsertoModelUser(user), page.Offset, page.Limit, page.SortBy, page.Dir)
+	if err != nil {
+		logger.Errorw("error while retrieving definitions from database", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	apiDefinitions := make([]ExportDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		apiDefinitions = append(apiDefinitions, DBDefinitionToAPI(*definition))
+	}
+
+	resp, err := middleware.GetPaginatedResponse(r.URL, page, count, apiDefinitions)
+	if err != nil {
+		logger.Errorw("error while paginating data", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// GetDefinition handles GET requests to the /exports/definitions/{definitionUUID} endpoint.
+func (e *Export) GetDefinition(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	definition := e.getDefinitionWithUser(w, r, logger)
+	if definition == nil {
+		return
+	}
+
+	apiDefinition := DBDefinitionToAPI(*definition)
+	if err := json.NewEncoder(w).Encode(&apiDefinition); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// PutDefinition handles PUT requests to the /exports/definitions/{definitionUUID}
+// endpoint. The name, format and sources of the definition are replaced.
+func (e *Export) PutDefinition(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	existing := e.getDefinitionWithUser(w, r, logger)
+	if existing == nil {
+		return
+	}
+
+	definition := decodeDefinition(w, r, logger)
+	if definition == nil {
+		return
+	}
+	definition.ID = existing.ID
+	definition.CreatedAt = existing.CreatedAt
+	definition.User = existing.User
+
+	if err := e.DB.UpdateDefinition(definition); err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", definition.ID))
+			return
+		default:
+			logger.Errorw("error updating definition entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	apiDefinition := DBDefinitionToAPI(*definition)
+	if err := json.NewEncoder(w).Encode(&apiDefinition); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// DeleteDefinition handles DELETE requests to the /exports/definitions/{definitionUUID}
+// endpoint. Exports which were created from the definition are not affected.
+func (e *Export) DeleteDefinition(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	uid := chi.URLParam(r, "definitionUUID")
+	definitionUUID, err := uuid.Parse(uid)
+	if err != nil {
+		BadRequestError(w, fmt.Sprintf("'%s' is not a valid definition UUID", uid))
+		return
+	}
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if err := e.DB.DeleteDefinition(definitionUUID, mapUsertoModelUser(user)); err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", definitionUUID))
+			return
+		default:
+			logger.Errorw("error deleting definition entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunDefinition handles POST requests to the /exports/definitions/{definitionUUID}/run
+// endpoint. It creates a new export from the definition, exactly as if its
+// contents had been sent to the /exports endpoint.
+func (e *Export) RunDefinition(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	definition := e.getDefinitionWithUser(w, r, logger)
+	if definition == nil {
+		return
+	}
+
+	// the exportable applications may have changed since the definition was saved
+	if err := verifyExportableApplication(config.Get().ExportableApplications, definitionSources(definition.Sources)); err != nil {
+		logger.Errorw("Definition does not match Configured Exports", "error", err)
+		StatusNotAcceptableError(w, "Definition does not match Configured Exports")
+		return
+	}
+	if err := verifyFormat(config.Get().ExportableResources, definition.Format, definitionSources(definition.Sources)); err != nil {
+		logger.Errorw("Definition format is not supported by its sources", "error", err)
+		StatusNotAcceptableError(w, err.Error())
+		return
+	}
+
+	// and so may the schemas of the filters
+	if fieldErrors := validateFilters(config.Get().ExportableResources, definitionSources(definition.Sources)); len(fieldErrors) > 0 {
+		logger.Infow("definition filters do not match their schema", "errors", fieldErrors)
+		FieldsError(w, "invalid filters", fieldErrors)
+		return
+	}
+
+	e.createExport(w, r, logger.With("definition_id", definition.ID), definition.NewExportPayload())
+}
+
+// decodeDefinition decodes and validates the definition in the body of the
+// request. An error response is written, and nil returned, if it is invalid.
+func decodeDefinition(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger) *models.ExportDefinition {
+	var apiDefinition ExportDefinition
+	if err := json.NewDecoder(r.Body).Decode(&apiDefinition); err != nil {
+		logger.Errorw("error while parsing params", "error", err)
+		BadRequestError(w, err.Error())
+		return nil
+	}
+
+	if apiDefinition.Name == "" {
+		BadRequestError(w, "no name provided")
+		return nil
+	}
+
+	if len(apiDefinition.Sources) == 0 {
+		BadRequestError(w, "no sources provided")
+		return nil
+	}
+
+	definition, err := APIDefinitionToDB(apiDefinition)
+	if err != nil {
+		logger.Errorw("unable to convert api definition into db definition", "error", err)
+		BadRequestError(w, err.Error())
+		return nil
+	}
+
+	if err := verifyExportableApplication(config.Get().ExportableApplications, definitionSources(definition.Sources)); err != nil {
+		logger.Errorw("Definition does not match Configured Exports", "error", err)
+		StatusNotAcceptableError(w, "Definition does not match Configured Exports")
+		return nil
+	}
+
+	if err := verifyFormat(config.Get().ExportableResources, definition.Format, definitionSources(definition.Sources)); err != nil {
+		logger.Infow("format is not supported by the sources", "error", err)
+		BadRequestError(w, err.Error())
+		return nil
+	}
+
+	if fieldErrors := validateFilters(config.Get().ExportableResources, definitionSources(definition.Sources)); len(fieldErrors) > 0 {
+		logger.Infow("definition filters do not match their schema", "errors", fieldErrors)
+		FieldsError(w, "invalid filters", fieldErrors)
+		return nil
+	}
+	return definition
+}
+
+func (e *Export) getDefinitionWithUser(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger) *models.ExportDefinition {
+	uid := chi.URLParam(r, "definitionUUID")
+	definitionUUID, err := uuid.Parse(uid)
+	if err != nil {
+		BadRequestError(w, fmt.Sprintf("'%s' is not a valid definition UUID", uid))
+		return nil
+	}
+
+	user := middleware.GetUserIdentity(r.Context())
+
+	definition, err := e.DB.GetDefinition(definitionUUID, mapUsertoModelUser(user))
+	if err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			logger.Infof("record '%s' not found", definitionUUID)
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", definitionUUID))
+			return nil
+		default:
+			logger.Errorw("error querying for definition entry", "error", err)
+			InternalServerError(w, err)
+			return nil
+		}
+	}
+
+	return definition
+}
+
+// definitionSources converts the sources of a definition for verifyExportableApplication,
+// verifyFormat and validateFilters.
+func definitionSources(sources []models.DefinitionSource) []Source {
+	result := make([]Source, 0, len(sources))
+	for _, source := range sources {
+		result = append(result, Source{Application: source.Application, Resource: source.Resource, Filters: source.Filters})
+	}
+	return result
+}
+
+func DBDefinitionToAPI(definition models.ExportDefinition) ExportDefinition {
+	apiDefinition := ExportDefinition{
+		ID:        definition.ID.String(),
+		CreatedAt: definition.CreatedAt.UTC(),
+		UpdatedAt: definition.UpdatedAt.UTC(),
+		Name:      definition.Name,
+		Format:    string(definition.Format),
+		Sources:   make([]DefinitionSource, 0, len(definition.Sources)),
+	}
+	for _, source := range definition.Sources {
+		apiDefinition.Sources = append(apiDefinition.Sources, DefinitionSource(source))
+	}
+	return apiDefinition
+}
+
+func APIDefinitionToDB(apiDefinition ExportDefinition) (*models.ExportDefinition, error) {
+	format, err := parseFormat(apiDefinition.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]models.DefinitionSource, 0, len(apiDefinition.Sources))
+	for _, source := range apiDefinition.Sources {
+		if err := verifyFilters(source.Filters); err != nil {
+			return nil, err
+		}
+		sources = append(sources, models.DefinitionSource(source))
+	}
+
+	return &models.ExportDefinition{
+		Name:    apiDefinition.Name,
+		Format:  format,
+		Sources: datatypes.NewJSONSlice(sources),
+	}, nil
+}
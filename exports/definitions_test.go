@@ -0,0 +1,200 @@
+package exports_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/exports"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+const testDefinition = `{
+	"name": "Weekly report",
+	"format": "csv",
+	"sources": [
+		{"application": "exampleApp", "resource": "exampleResource", "filters": {"severity": "high"}},
+		{"application": "exampleApp", "resource": "anotherExampleResource"}
+	]
+}`
+
+// exportsRequest sends a request with a JSON body to the path under
+// /api/export/v1/exports, such as /definitions or /schedules.
+func exportsRequest(router chi.Router, method, path, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest(method, "/api/export/v1/exports"+path, strings.NewReader(body))
+	Expect(err).ShouldNot(HaveOccurred())
+	req.Header.Set("Content-Type", "application/json")
+
+	AddDebugUserIdentity(req)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func createTestDefinition(router chi.Router) exports.ExportDefinition {
+	rr := exportsRequest(router, "POST", "/definitions", testDefinition)
+	Expect(rr.Code).To(Equal(http.StatusCreated))
+
+	var definition exports.ExportDefinition
+	err := json.Unmarshal(rr.Body.Bytes(), &definition)
+	Expect(err).ShouldNot(HaveOccurred())
+	return definition
+}
+
+var _ = Describe("Export definitions", func() {
+	It("can create and get a definition", func() {
+		router := setupTest(mockRequestApplicationResources)
+
+		definition := createTestDefinition(router)
+		Expect(definition.ID).ToNot(BeEmpty())
+		Expect(definition.Name).To(Equal("Weekly report"))
+		Expect(definition.Format).To(Equal("csv"))
+		Expect(definition.Sources).To(HaveLen(2))
+		Expect(definition.Sources[0].Application).To(Equal("exampleApp"))
+		Expect(definition.Sources[0].Resource).To(Equal("exampleResource"))
+		Expect(definition.Sources[0].Filters).To(MatchJSON(`{"severity": "high"}`))
+
+		rr := exportsRequest(router, "GET", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var fetched exports.ExportDefinition
+		err := json.Unmarshal(rr.Body.Bytes(), &fetched)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fetched.ID).To(Equal(definition.ID))
+		Expect(fetched.Sources).To(HaveLen(2))
+		Expect(fetched.Sources[1].Resource).To(Equal("anotherExampleResource"))
+	})
+
+	It("can list definitions", func() {
+		router := setupTest(mockRequestApplicationResources)
+
+		createTestDefinition(router)
+		createTestDefinition(router)
+
+		rr := exportsRequest(router, "GET", "/definitions?limit=1", "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var resp struct {
+			Meta struct {
+				Count int `json:"count"`
+			} `json:"meta"`
+			Data []exports.ExportDefinition `json:"data"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(resp.Meta.Count).To(Equal(2))
+		Expect(resp.Data).To(HaveLen(1))
+
+		rr = exportsRequest(router, "GET", "/definitions?sort=expires", "")
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("can update a definition", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+
+		rr := exportsRequest(router, "PUT", "/definitions/"+definition.ID, `{"name": "Daily report", "format": "json", "sources": [{"application": "exampleApp", "resource": "exampleResource"}]}`)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		rr = exportsRequest(router, "GET", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var updated exports.ExportDefinition
+		err := json.Unmarshal(rr.Body.Bytes(), &updated)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(updated.Name).To(Equal("Daily report"))
+		Expect(updated.Format).To(Equal("json"))
+		Expect(updated.Sources).To(HaveLen(1))
+		Expect(updated.CreatedAt).To(BeTemporally("~", definition.CreatedAt))
+	})
+
+	It("can delete a definition", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+
+		rr := exportsRequest(router, "DELETE", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNoContent))
+
+		rr = exportsRequest(router, "GET", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+
+		rr = exportsRequest(router, "DELETE", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+
+	DescribeTable("validates definitions", func(body string, expectedStatus int, expectedBody string) {
+		router := setupTest(mockRequestApplicationResources)
+
+		rr := exportsRequest(router, "POST", "/definitions", body)
+		Expect(rr.Code).To(Equal(expectedStatus))
+		Expect(rr.Body.String()).To(ContainSubstring(expectedBody))
+	},
+		Entry("missing name",
+			`{"format": "csv", "sources": [{"application": "exampleApp", "resource": "exampleResource"}]}`,
+			http.StatusBadRequest, "no name provided"),
+		Entry("missing sources",
+			`{"name": "test", "format": "csv", "sources": []}`,
+			http.StatusBadRequest, "no sources provided"),
+		Entry("invalid format",
+			`{"name": "test", "format": "xml", "sources": [{"application": "exampleApp", "resource": "exampleResource"}]}`,
+			http.StatusBadRequest, "invalid or missing payload format"),
+		Entry("invalid filters",
+			`{"name": "test", "format": "csv", "sources": [{"application": "exampleApp", "resource": "exampleResource", "filters": [1]}]}`,
+			http.StatusBadRequest, "invalid json format of filters"),
+		Entry("unknown application",
+			`{"name": "test", "format": "csv", "sources": [{"application": "fakeApp", "resource": "exampleResource"}]}`,
+			http.StatusNotAcceptable, "Definition does not match Configured Exports"),
+	)
+
+	It("can run a definition to create an export", func() {
+		var requested *models.ExportPayload
+
+		mockKafkaCall := func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload) {
+			requested = &payload
+		}
+
+		router := setupTest(mockKafkaCall)
+		definition := createTestDefinition(router)
+
+		rr := exportsRequest(router, "POST", fmt.Sprintf("/definitions/%s/run", definition.ID), "")
+		Expect(rr.Code).To(Equal(http.StatusAccepted))
+
+		var export exports.ExportPayload
+		err := json.Unmarshal(rr.Body.Bytes(), &export)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(export.Name).To(Equal("Weekly report"))
+		Expect(export.Format).To(Equal("csv"))
+		Expect(export.Status).To(Equal("pending"))
+		Expect(export.Sources).To(HaveLen(2))
+		Expect(export.Sources[0].Status).To(Equal("pending"))
+		Expect(export.Sources[0].Filters).To(MatchJSON(`{"severity": "high"}`))
+
+		Expect(requested).ToNot(BeNil())
+		Expect(requested.ID.String()).To(Equal(export.ID))
+		Expect(requested.Sources).To(HaveLen(2))
+
+		// running it again creates another export
+		rr = exportsRequest(router, "POST", fmt.Sprintf("/definitions/%s/run", definition.ID), "")
+		Expect(rr.Code).To(Equal(http.StatusAccepted))
+		Expect(rr.Body.String()).ToNot(ContainSubstring(export.ID))
+	})
+
+	It("returns not found for an unknown definition", func() {
+		router := setupTest(mockRequestApplicationResources)
+
+		rr := exportsRequest(router, "POST", fmt.Sprintf("/definitions/%s/run", uuid.New()), "")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+
+		rr = exportsRequest(router, "GET", "/definitions/not-a-uuid", "")
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,300 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+	es3 "github.com/redhatinsights/export-service-go/s3"
+)
+
+var errUnsatisfiableRange = errors.New("requested range not satisfiable")
+
+// byteRange is an inclusive range of bytes within an object.
+type byteRange struct {
+	start, end int64
+}
+
+func (br byteRange) length() int64 {
+	return br.end - br.start + 1
+}
+
+// header formats the range for an S3 GetObject request.
+func (br byteRange) header() string {
+	return fmt.Sprintf("bytes=%d-%d", br.start, br.end)
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.end, size)
+}
+
+// parseRange parses the value of a Range header for an object of the given size.
+// Only a single range is supported; a missing, malformed or multi-part range
+// returns nil so that the whole object is served, as permitted by RFC 9110.
+func parseRange(header string, size int64) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	if first == "" {
+		// suffix range, e.g. `bytes=-500` for the last 500 bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		return &byteRange{start: size - n, end: size - 1}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return nil, errUnsatisfiableRange
+	}
+	return &byteRange{start: start, end: end}, nil
+}
+
+// etagMatches reports whether the If-None-Match style list contains etag,
+// using the weak comparison function.
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since preconditions.
+func notModified(r *http.Request, info *es3.ObjectInfo) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, info.ETag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !info.LastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !info.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// rangeApplies evaluates the If-Range precondition. A range is only honoured if
+// the client's copy is still current, otherwise the whole object is sent.
+func rangeApplies(r *http.Request, info *es3.ObjectInfo) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		// If-Range requires the strong comparison function
+		return info.ETag != "" && !strings.HasPrefix(info.ETag, "W/") && ir == info.ETag
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil || info.LastModified.IsZero() {
+		return false
+	}
+	return info.LastModified.Truncate(time.Second).Equal(t)
+}
+
+// formatContentType returns the media type of the data uploaded in format.
+func formatContentType(format models.PayloadFormat) string {
+	switch format {
+	case models.CSV:
+		return "text/csv"
+	case models.NDJSON:
+		return "application/x-ndjson"
+	case models.XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case models.Parquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/json"
+	}
+}
+
+// archiveContentType returns the media type of archives of the format, which
+// are encrypted with encryption.
+func archiveContentType(format models.ArchiveFormat, encryption models.EncryptionType) string {
+	switch encryption {
+	case models.AgeEncryption:
+		return "application/octet-stream"
+	case models.PGPEncryption:
+		return "application/pgp-encrypted"
+	}
+
+	switch format {
+	case models.TarGz:
+		return "application/gzip"
+	case models.TarZst:
+		return "application/zstd"
+	default:
+		return "application/zip"
+	}
+}
+
+// deadlineWriter pushes the write deadline of the connection forward before each
+// write. Downloads are then only cut off when the client stops reading, rather
+// than when the server-wide write timeout elapses in the middle of a large file.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func newDeadlineWriter(w http.ResponseWriter, timeout time.Duration) *deadlineWriter {
+	return &deadlineWriter{w: w, rc: http.NewResponseController(w), timeout: timeout}
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	if dw.timeout > 0 {
+		// not every ResponseWriter supports deadlines (e.g. in tests); those
+		// simply keep their existing behaviour
+		_ = dw.rc.SetWriteDeadline(time.Now().Add(dw.timeout))
+	}
+	return dw.w.Write(p)
+}
+
+// serveObject streams the object stored under key to the client without
+// buffering it. It supports single byte-range requests as well as the
+// If-None-Match, If-Modified-Since and If-Range preconditions so that clients
+// can resume interrupted downloads.
+func (e *Export) serveObject(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, key, filename string) {
+	info, err := e.StorageHandler.HeadObject(r.Context(), logger, key)
+	if err != nil {
+		logger.Errorw("failed to get object metadata", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	if info.ETag != "" {
+		h.Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		h.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, info) {
+		h.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var rng *byteRange
+	if rangeApplies(r, info) {
+		rng, err = parseRange(r.Header.Get("Range"), info.ContentLength)
+		if err != nil {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", info.ContentLength))
+			JSONError(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	length := info.ContentLength
+	var s3Range string
+	if rng != nil {
+		status = http.StatusPartialContent
+		length = rng.length()
+		s3Range = rng.header()
+		h.Set("Content-Range", rng.contentRange(info.ContentLength))
+	}
+
+	// the headers and the range are those of the object that was looked up,
+	// so its body is only served if it was not replaced since
+	out, err := e.StorageHandler.GetObject(r.Context(), logger, key, s3Range, info.ETag)
+	if errors.Is(err, es3.ErrObjectChanged) {
+		logger.Infow("object was replaced while it was being served", "key", key)
+		h.Del("Content-Range")
+		JSONError(w, "the export was changed while it was being downloaded, retry the download", http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		logger.Errorw("failed to get object", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Errorw("failed to close body", "error", err)
+		}
+	}()
+
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+
+	if _, err := io.Copy(newDeadlineWriter(w, config.Get().PublicHttpServerWriteTimeout), out); err != nil {
+		logger.Warnw("download was interrupted", "error", err)
+	}
+}
+
+// redirectToObject redirects the client to a short-lived presigned URL for the
+// object stored under key, so that the download bypasses this service. The URL
+// never outlives the export itself.
+func (e *Export) redirectToObject(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, export *models.ExportPayload, key, filename string) {
+	expiry := config.Get().StorageConfig.PresignedURLExpiry
+	if export.Expires != nil {
+		remaining := time.Until(*export.Expires)
+		if remaining < time.Second {
+			GoneError(w, fmt.Sprintf("'%s' has expired", export.ID))
+			return
+		}
+		if remaining < expiry {
+			expiry = remaining
+		}
+	}
+
+	url, err := e.StorageHandler.PresignGetObject(r.Context(), logger, key, filename, expiry)
+	if err != nil {
+		logger.Errorw("failed to presign object", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	w.Header().Del("Content-Type")
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, url, http.StatusFound)
+}
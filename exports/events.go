@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/events"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/middleware"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// GetExportEvents handles GET requests to the /exports/{exportUUID}/events
+// endpoint. The current status of the export and of its sources is sent first,
+// followed by every change as a server-sent event.
+func (e *Export) GetExportEvents(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if e.Events == nil {
+		NotImplementedError(w)
+		return
+	}
+
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
+	}
+
+	logger = logger.With(export_logger.ExportIDField(export.ID.String()))
+
+	// subscribe before the current status is read, so that no change is missed
+	sub := e.Events.Subscribe(mapUsertoModelUser(user), export.ID)
+	defer e.Events.Unsubscribe(sub)
+
+	export, err := e.DB.GetWithUser(export.ID, mapUsertoModelUser(user))
+	if err != nil {
+		logger.Errorw("error querying for payload entry", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	e.streamEvents(w, r, logger, sub, currentStatusEvents(export))
+}
+
+// ListExportEvents handles GET requests to the /exports/events endpoint. Every
+// status change of any export of the user is sent as a server-sent event.
+func (e *Export) ListExportEvents(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if e.Events == nil {
+		NotImplementedError(w)
+		return
+	}
+
+	sub := e.Events.Subscribe(mapUsertoModelUser(user), uuid.Nil)
+	defer e.Events.Unsubscribe(sub)
+
+	e.streamEvents(w, r, logger, sub, nil)
+}
+
+// currentStatusEvents describes the current status of an export and its sources.
+func currentStatusEvents(export *models.ExportPayload) []events.StatusEvent {
+	result := []events.StatusEvent{{
+		Type:     events.ExportEvent,
+		ExportID: export.ID,
+		Status:   string(export.Status),
+	}}
+	for _, source := range export.Sources {
+		result = append(result, events.StatusEvent{
+			Type:     events.SourceEvent,
+			ExportID: export.ID,
+			SourceID: &source.ID,
+			Status:   string(source.Status),
+		})
+	}
+	return result
+}
+
+// streamEvents writes initial, and then the events of the subscription, to the
+// client until either side closes the stream. A comment is sent whenever the
+// stream has been idle for EVENTS_HEARTBEAT_INTERVAL so that proxies keep the
+// connection open.
+func (e *Export) streamEvents(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, sub *events.Subscription, initial []events.StatusEvent) {
+	cfg := config.Get()
+	rc := http.NewResponseController(w)
+	out := newDeadlineWriter(w, cfg.PublicHttpServerWriteTimeout)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event events.StatusEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	for _, event := range initial {
+		if err := send(event); err != nil {
+			logger.Infow("status event stream closed", "error", err)
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		logger.Errorw("status event stream cannot be flushed", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.EventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				logger.Info("status event subscription ended")
+				return
+			}
+			err = send(event)
+			heartbeat.Reset(cfg.EventsHeartbeatInterval)
+		case <-heartbeat.C:
+			if _, err = io.WriteString(out, ": heartbeat\n\n"); err == nil {
+				err = rc.Flush()
+			}
+		}
+		if err != nil {
+			logger.Infow("status event stream closed", "error", err)
+			return
+		}
+	}
+}
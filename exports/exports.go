@@ -5,11 +5,15 @@ SPDX-License-Identifier: Apache-2.0
 package exports
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
 
 	chi "github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -17,31 +21,50 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/events"
 	export_logger "github.com/redhatinsights/export-service-go/logger"
 	"github.com/redhatinsights/export-service-go/middleware"
 	"github.com/redhatinsights/export-service-go/models"
 	es3 "github.com/redhatinsights/export-service-go/s3"
-	"golang.org/x/time/rate"
 )
 
+// maxIdempotencyKeyLength is the maximum length of an Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
 // Export holds any dependencies necessary for the external api endpoints
 type Export struct {
-	Bucket              string
-	StorageHandler      es3.StorageHandler
-	DB                  models.DBInterface
-	Log                 *zap.SugaredLogger
-	RequestAppResources RequestApplicationResources
-	RateLimiter         *rate.Limiter
+	Bucket                string
+	StorageHandler        es3.StorageHandler
+	DB                    models.DBInterface
+	Log                   *zap.SugaredLogger
+	RequestAppResources   RequestApplicationResources
+	CancelAppResources    CancelApplicationResources
+	PublishLifecycleEvent PublishLifecycleEvent
+	Events                *events.Broker
+	RateLimits            middleware.RateLimits
 }
 
 // ExportRouter is a router for all of the external routes for the /exports endpoint.
+// Every route is rate limited with the class of RateLimits it belongs to.
 func (e *Export) ExportRouter(r chi.Router) {
-	r.Post("/", e.PostExport)
-	r.With(middleware.PaginationCtx).Get("/", e.ListExports)
+	r.With(e.RateLimits.Create.Limit).Post("/", e.PostExport)
+	r.With(e.RateLimits.List.Limit, middleware.PaginationCtx).Get("/", e.ListExports)
+	r.Route("/definitions", e.DefinitionRouter)
+	r.With(e.RateLimits.List.Limit).Route("/schedules", e.ScheduleRouter)
+	r.With(e.RateLimits.List.Limit).Get("/events", e.ListExportEvents)
 	r.Route("/{exportUUID}", func(sub chi.Router) {
-		sub.With(middleware.GZIPContentType).Get("/", e.GetExport)
-		sub.Delete("/", e.DeleteExport)
-		sub.Get("/status", e.GetExportStatus)
+		sub.With(e.RateLimits.Download.Limit).Get("/", e.GetExport)
+		sub.With(e.RateLimits.Download.Limit).Get("/sources/{sourceUUID}", e.GetExportSource)
+		sub.With(e.RateLimits.Create.Limit).Post("/retry", e.RetryExport)
+		sub.Group(func(sub chi.Router) {
+			sub.Use(e.RateLimits.List.Limit)
+			sub.Patch("/", e.PatchExport)
+			sub.Delete("/", e.DeleteExport)
+			sub.Get("/status", e.GetExportStatus)
+			sub.Get("/events", e.GetExportEvents)
+			sub.Get("/deliveries", e.GetWebhookDeliveries)
+			sub.Post("/cancel", e.CancelExport)
+		})
 	})
 }
 
@@ -59,19 +82,10 @@ func (e *Export) PostExport(w http.ResponseWriter, r *http.Request) {
 	reqID := request_id.GetReqID(r.Context())
 	user := middleware.GetUserIdentity(r.Context())
 
-	modelUser := mapUsertoModelUser(user)
-
 	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
 
-	err := e.RateLimiter.Wait(r.Context())
-	if err != nil {
-		logger.Errorw("Rate limit reached", "error", err)
-		InternalServerError(w, err)
-		return
-	}
-
 	var apiExport ExportPayload
-	err = json.NewDecoder(r.Body).Decode(&apiExport)
+	err := json.NewDecoder(r.Body).Decode(&apiExport)
 	if err != nil {
 		logger.Errorw("error while parsing params", "error", err)
 		BadRequestError(w, err.Error())
@@ -92,6 +106,12 @@ func (e *Export) PostExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if fieldErrors := validateFilters(cfg.ExportableResources, apiExport.Sources); len(fieldErrors) > 0 {
+		logger.Infow("filters do not match their schema", "errors", fieldErrors)
+		FieldsError(w, "invalid filters", fieldErrors)
+		return
+	}
+
 	dbExport, err := APIExportToDBExport(apiExport)
 	if err != nil {
 		logger.Errorw("unable to convert api export into db export", "error", err)
@@ -99,36 +119,136 @@ func (e *Export) PostExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbExport.RequestID = reqID
-	dbExport.User = modelUser
+	if err = verifyFormat(cfg.ExportableResources, dbExport.Format, apiExport.Sources); err != nil {
+		logger.Infow("format is not supported by the sources", "error", err)
+		BadRequestError(w, err.Error())
+		return
+	}
 
-	dbExport, err = e.DB.Create(dbExport)
-	if err != nil {
-		logger.Errorw("error creating payload entry", "error", err)
-		InternalServerError(w, err)
+	e.createExport(w, r, logger, dbExport)
+}
+
+// createExport stores a new export for the user making the request, responds
+// with it and requests its sources from the applications. If the request has an
+// Idempotency-Key which was already used for the same export, the existing
+// export is returned and nothing is requested again. Otherwise the export is
+// refused if the organization of the user exceeds its quota.
+func (e *Export) createExport(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, dbExport *models.ExportPayload) {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLength {
+		BadRequestError(w, fmt.Sprintf("Idempotency-Key must not be longer than %d characters", maxIdempotencyKeyLength))
 		return
 	}
 
-	// Extract application names from sources for logging
-	applicationNames := make([]string, 0, len(apiExport.Sources))
-	for _, source := range apiExport.Sources {
-		applicationNames = append(applicationNames, source.Application)
+	user := middleware.GetUserIdentity(r.Context())
+	dbExport, created, err := newExport(
+		e.DB,
+		dbExport,
+		request_id.GetReqID(r.Context()),
+		r.Header.Get("X-Rh-Identity"),
+		mapUsertoModelUser(user),
+		key,
+		func(tx *models.ExportDB) error { return checkQuota(tx, user.OrganizationID) },
+	)
+	if err != nil {
+		var quotaErr *quotaError
+		switch {
+		case errors.Is(err, models.ErrIdempotencyKeyReused):
+			UnprocessableEntityError(w, "Idempotency-Key was already used for a different export request")
+			return
+		case errors.As(err, &quotaErr):
+			logger.Warnw("export quota exceeded", "error", err)
+			JSONError(w, quotaErr.msg, quotaErr.code)
+			return
+		default:
+			logger.Errorw("error creating payload entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
 	}
 
-	logger = logger.With(export_logger.ExportIDField(dbExport.ID.String()), export_logger.ApplicationNamesField(applicationNames))
-	logger.Infow("export created successfully", "export_name", dbExport.Name)
+	logger = logger.With(export_logger.ExportIDField(dbExport.ID.String()), export_logger.ApplicationNamesField(applicationNames(dbExport.Sources)))
+	if created {
+		logger.Infow("export created successfully", "export_name", dbExport.Name)
+	} else {
+		logger.Infow("export with the same idempotency key already exists", "export_name", dbExport.Name)
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 
-	apiExport = DBExportToAPI(*dbExport)
+	apiExport := DBExportToAPI(*dbExport)
 	if err := json.NewEncoder(w).Encode(&apiExport); err != nil {
 		logger.Errorw("error while trying to encode", "error", err)
 		InternalServerError(w, err.Error())
 	}
 
+	if !created {
+		return
+	}
+
+	e.PublishLifecycleEvent(logger, ExportCreated, *dbExport)
+
 	// send the payload to the producer with a goroutine so
 	// that we do not block the response
-	e.RequestAppResources(r.Context(), logger, r.Header["X-Rh-Identity"][0], *dbExport)
+	e.RequestAppResources(r.Context(), logger, r.Header.Get("X-Rh-Identity"), *dbExport)
+}
+
+// retriedIdentity returns the identity header which has to be kept for the
+// automatic retries of sources, i.e. identity if the application of any of the
+// sources has a retry policy, and nothing otherwise.
+func retriedIdentity(sources []models.Source, identity string) string {
+	policies := config.Get().RetryPolicies
+	for _, source := range sources {
+		if _, ok := policies[source.Application]; ok {
+			return identity
+		}
+	}
+	return ""
+}
+
+// newExport stores payload as a new export of user, made by the request with
+// the given ID and identity header. The identity is only kept if sources of the
+// export may be retried automatically, see retriedIdentity.
+//
+// If key is not empty and the user already created an export with the same
+// idempotency key within the configured window, that export is returned
+// instead and created is false. Otherwise allow is called with the transaction
+// which creates the export, see ExportDB.CreateAllowed, and its error is
+// returned instead.
+//
+// Exports without an expiry expire after the shortest expiry of their
+// resources, if they have one. Sources are requested in a format that their
+// application produces, see sourceFormat.
+func newExport(db models.DBInterface, payload *models.ExportPayload, requestID, identity string, user models.User, key string, allow func(tx *models.ExportDB) error) (export *models.ExportPayload, created bool, err error) {
+	payload.RequestID = requestID
+	payload.User = user
+	payload.Identity = retriedIdentity(payload.Sources, identity)
+
+	if key != "" {
+		payload.IdempotencyKey = key
+		// the default expiry changes with time, it must not change the hash
+		payload.RequestHash = requestHash(payload)
+	}
+
+	resources := config.Get().ExportableResources
+	if payload.Expires == nil {
+		payload.Expires = resourceExpiry(resources, payload.Sources)
+	}
+	for i := range payload.Sources {
+		payload.Sources[i].Format = sourceFormat(resources, payload.Format, payload.Sources[i])
+	}
+
+	return db.CreateAllowed(payload, config.Get().IdempotencyWindow, allow)
+}
+
+// applicationNames extracts the application names from sources for logging.
+func applicationNames(sources []models.Source) []string {
+	names := make([]string, 0, len(sources))
+	for _, source := range sources {
+		names = append(names, source.Application)
+	}
+	return names
 }
 
 // verifyEdportableApplications verifies if an application or resource is in the map
@@ -157,13 +277,6 @@ func (e *Export) ListExports(w http.ResponseWriter, r *http.Request) {
 
 	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
 
-	err := e.RateLimiter.Wait(r.Context())
-	if err != nil {
-		logger.Errorw("Rate limit reached", "error", err)
-		InternalServerError(w, err)
-		return
-	}
-
 	q := r.URL.Query()
 
 	params, err := initQuery(q)
@@ -194,7 +307,8 @@ func (e *Export) ListExports(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetExport handles GET requests to the /exports/{exportUUID} endpoint.
-// This function is responsible for returning the S3 object.
+// This function is responsible for streaming the S3 object to the client, or
+// redirecting the client to a presigned S3 URL when `?redirect=true` is given.
 func (e *Export) GetExport(w http.ResponseWriter, r *http.Request) {
 	reqID := request_id.GetReqID(r.Context())
 	user := middleware.GetUserIdentity(r.Context())
@@ -206,38 +320,73 @@ func (e *Export) GetExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := e.RateLimiter.Wait(r.Context())
-	if err != nil {
-		logger.Errorw("Rate limit reached", "error", err)
-		InternalServerError(w, err)
-		return
-	}
-
 	if export.Status != models.Complete && export.Status != models.Partial {
 		logger.Infof("'%s' not ready for download", export.ID)
 		BadRequestError(w, fmt.Sprintf("'%s' is not ready for download", export.ID))
 		return
 	}
 
-	out, err := e.StorageHandler.GetObject(r.Context(), logger, export.S3Key)
+	filename := filepath.Base(export.S3Key)
+	w.Header().Set("Content-Type", archiveContentType(export.Archive, export.Encryption.Type))
+
+	if redirect, _ := strconv.ParseBool(r.URL.Query().Get("redirect")); redirect {
+		e.redirectToObject(w, r, logger, export, export.S3Key, filename)
+		return
+	}
+
+	e.serveObject(w, r, logger, export.S3Key, filename)
+}
+
+// GetExportSource handles GET requests to the /exports/{exportUUID}/sources/{sourceUUID}
+// endpoint. It streams the data uploaded for a single source, which is available
+// as soon as that source is complete, regardless of the other sources.
+func (e *Export) GetExportSource(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	uid := chi.URLParam(r, "sourceUUID")
+	sourceUUID, err := uuid.Parse(uid)
 	if err != nil {
-		logger.Errorw("failed to get object", "error", err)
-		InternalServerError(w, err)
+		BadRequestError(w, fmt.Sprintf("'%s' is not a valid source UUID", uid))
 		return
 	}
 
-	baseName := filepath.Base(export.S3Key)
-	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", baseName))
-	w.WriteHeader(http.StatusOK)
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(out); err != nil {
-		logger.Errorf("failed to read body: %w", err)
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
 	}
-	err = out.Close()
+
+	logger = logger.With(export_logger.ExportIDField(export.ID.String()))
+
+	_, source, err := export.GetSource(sourceUUID)
 	if err != nil {
-		logger.Errorf("failed to close body: %w", err)
+		logger.Infof("source '%s' not found", sourceUUID)
+		NotFoundError(w, fmt.Sprintf("source '%s' not found", sourceUUID))
+		return
+	}
+
+	if export.Encryption.Type != "" {
+		ForbiddenError(w, fmt.Sprintf("'%s' is encrypted, its sources can only be downloaded in its archive", export.ID))
+		return
+	}
+
+	if source.Status != models.RComplete {
+		logger.Infof("source '%s' not ready for download", sourceUUID)
+		BadRequestError(w, fmt.Sprintf("source '%s' is not ready for download", sourceUUID))
+		return
+	}
+
+	key := es3.SourceKey(export, *source)
+	w.Header().Set("Content-Type", formatContentType(source.Format))
+
+	if redirect, _ := strconv.ParseBool(r.URL.Query().Get("redirect")); redirect {
+		e.redirectToObject(w, r, logger, export, key, filepath.Base(key))
+		return
 	}
-	Logerr(w.Write(buf.Bytes()))
+
+	e.serveObject(w, r, logger, key, filepath.Base(key))
 }
 
 // DeleteExport handles DELETE requests to the /exports/{exportUUID} endpoint.
@@ -254,16 +403,14 @@ func (e *Export) DeleteExport(w http.ResponseWriter, r *http.Request) {
 
 	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.ExportIDField(uid), export_logger.OrgIDField(user.OrganizationID))
 
-	err = e.RateLimiter.Wait(r.Context())
-	if err != nil {
-		logger.Errorw("Rate limit reached", "error", err)
-		InternalServerError(w, err)
-		return
-	}
-
 	modelUser := mapUsertoModelUser(user)
 
-	if err := e.DB.Delete(exportUUID, modelUser); err != nil {
+	// the export is read first so that the lifecycle event can describe it
+	export, err := e.DB.GetWithUser(exportUUID, modelUser)
+	if err == nil {
+		err = e.DB.Delete(exportUUID, modelUser)
+	}
+	if err != nil {
 		switch err {
 		case models.ErrRecordNotFound:
 			NotFoundError(w, fmt.Sprintf("record '%s' not found", exportUUID))
@@ -274,6 +421,8 @@ func (e *Export) DeleteExport(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	e.PublishLifecycleEvent(logger, ExportDeleted, *export)
 }
 
 // GetExportStatus handles GET requests to the /exports/{exportUUID}/status endpoint.
@@ -283,24 +432,255 @@ func (e *Export) GetExportStatus(w http.ResponseWriter, r *http.Request) {
 
 	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
 
-	err := e.RateLimiter.Wait(r.Context())
-	if err != nil {
-		logger.Errorw("Rate limit reached", "error", err)
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
+	}
+
+	apiExport := DBExportToAPI(*export)
+
+	if err := json.NewEncoder(w).Encode(&apiExport); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// PatchExport handles PATCH requests to the /exports/{exportUUID} endpoint. The
+// export can be renamed, and its expiry moved to any time in the future up to
+// EXPORT_MAX_EXPIRY_DAYS after the export was created.
+func (e *Export) PatchExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
+	}
+
+	logger = logger.With(export_logger.ExportIDField(export.ID.String()))
+
+	var update ExportUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		logger.Errorw("error while parsing params", "error", err)
+		BadRequestError(w, err.Error())
+		return
+	}
+
+	if update.Name == nil && update.Expires == nil {
+		BadRequestError(w, "no name or expires_at provided")
+		return
+	}
+
+	var name string
+	if update.Name != nil {
+		if *update.Name == "" {
+			BadRequestError(w, "name must not be empty")
+			return
+		}
+		name = *update.Name
+	}
+
+	if update.Expires != nil {
+		if !update.Expires.After(time.Now()) {
+			BadRequestError(w, "expires_at must be in the future")
+			return
+		}
+		latest := export.CreatedAt.AddDate(0, 0, config.Get().ExportMaxExpiryDays)
+		if update.Expires.After(latest) {
+			BadRequestError(w, fmt.Sprintf("expires_at must not be later than %s", latest.UTC().Format(time.RFC3339)))
+			return
+		}
+	}
+
+	if err := export.UpdateMetadata(e.DB, name, update.Expires); err != nil {
+		logger.Errorw("error updating payload entry", "error", err)
 		InternalServerError(w, err)
 		return
 	}
 
+	logger.Infow("export updated", "export_name", export.Name, "expires_at", export.Expires)
+
+	apiExport := DBExportToAPI(*export)
+	if err := json.NewEncoder(w).Encode(&apiExport); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// CancelExport handles POST requests to the /exports/{exportUUID}/cancel endpoint.
+// Only exports which are still pending or running can be cancelled. The source
+// applications which have not yet delivered their resource are notified so that
+// they can stop working on it.
+func (e *Export) CancelExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
 	export := e.getExportWithUser(w, r, logger)
 	if export == nil {
 		return
 	}
 
+	logger = logger.With(export_logger.ExportIDField(export.ID.String()))
+
+	var pending []models.Source
+	for _, source := range export.Sources {
+		if source.Status == models.RPending {
+			pending = append(pending, source)
+		}
+	}
+
+	status := export.Status
+	if err := export.SetStatusCancelled(e.DB); err != nil {
+		switch err {
+		case models.ErrNotCancellable:
+			logger.Infow("export can no longer be cancelled", "status", status)
+			ConflictError(w, fmt.Sprintf("'%s' is already %s and can no longer be cancelled", export.ID, status))
+			return
+		default:
+			logger.Errorw("error cancelling payload entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	logger.Infow("export cancelled", "pending_sources", len(pending))
+
 	apiExport := DBExportToAPI(*export)
+	if err := json.NewEncoder(w).Encode(&apiExport); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+
+	if len(pending) > 0 {
+		e.CancelAppResources(r.Context(), logger, r.Header.Get("X-Rh-Identity"), *export, pending)
+	}
+}
+
+// RetryExport handles POST requests to the /exports/{exportUUID}/retry endpoint.
+// The failed sources of a partial or failed export, or the subset of them given
+// in the request body, are requested from their applications again.
+func (e *Export) RetryExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	var retryRequest RetryRequest
+	if err := json.NewDecoder(r.Body).Decode(&retryRequest); err != nil && !errors.Is(err, io.EOF) {
+		logger.Errorw("error while parsing params", "error", err)
+		BadRequestError(w, err.Error())
+		return
+	}
+
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
+	}
+
+	logger = logger.With(export_logger.ExportIDField(export.ID.String()))
+
+	if export.Status != models.Partial && export.Status != models.Failed {
+		ConflictError(w, fmt.Sprintf("'%s' is %s, only partial or failed exports can be retried", export.ID, export.Status))
+		return
+	}
+
+	if export.Status == models.Partial && export.Encryption.Type != "" {
+		ConflictError(w, fmt.Sprintf("'%s' is encrypted, the data of its sources is no longer kept and it can not be retried", export.ID))
+		return
+	}
 
+	if export.Encryption.Type == models.PasswordEncryption {
+		ConflictError(w, fmt.Sprintf("'%s' is encrypted with a password, whose keys are no longer kept, and it can not be retried", export.ID))
+		return
+	}
+
+	retry, err := sourcesToRetry(export, retryRequest.Sources)
+	if err != nil {
+		BadRequestError(w, err.Error())
+		return
+	}
+	if len(retry) == 0 {
+		ConflictError(w, fmt.Sprintf("'%s' has no failed sources to retry", export.ID))
+		return
+	}
+
+	sourceIDs := make([]uuid.UUID, 0, len(retry))
+	for _, source := range retry {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+
+	status, archive := export.Status, export.S3Key
+	identity := retriedIdentity(retry, r.Header.Get("X-Rh-Identity"))
+	if err := export.RetrySources(e.DB, sourceIDs, identity); err != nil {
+		switch err {
+		case models.ErrNotRetryable:
+			ConflictError(w, fmt.Sprintf("'%s' is no longer %s and can not be retried", export.ID, status))
+			return
+		default:
+			logger.Errorw("error retrying payload entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	logger.Infow("retrying failed sources", "sources", sourceIDs)
+
+	// the export is compressed again once the retried sources are delivered,
+	// so its current archive is no longer needed
+	if archive != "" {
+		if err := e.StorageHandler.DeleteObject(r.Context(), logger, archive); err != nil {
+			logger.Errorw("failed to delete the archive of the retried export", "key", archive, "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	apiExport := DBExportToAPI(*export)
 	if err := json.NewEncoder(w).Encode(&apiExport); err != nil {
 		logger.Errorw("error while encoding", "error", err)
 		InternalServerError(w, err.Error())
 	}
+
+	// only the retried sources are sent to the applications again
+	retried := *export
+	retried.Sources = nil
+	for _, source := range export.Sources {
+		if slices.Contains(sourceIDs, source.ID) {
+			retried.Sources = append(retried.Sources, source)
+		}
+	}
+	e.RequestAppResources(r.Context(), logger, r.Header.Get("X-Rh-Identity"), retried)
+}
+
+// sourcesToRetry returns the sources of the export with the given ids, or all of
+// its failed sources when no ids are given. Every requested source must exist
+// and must have failed.
+func sourcesToRetry(export *models.ExportPayload, ids []uuid.UUID) ([]models.Source, error) {
+	var sources []models.Source
+	if len(ids) == 0 {
+		for _, source := range export.Sources {
+			if source.Status == models.RFailed {
+				sources = append(sources, source)
+			}
+		}
+		return sources, nil
+	}
+
+	for _, id := range ids {
+		_, source, err := export.GetSource(id)
+		if err != nil {
+			return nil, fmt.Errorf("source '%s' not found", id)
+		}
+		if source.Status != models.RFailed {
+			return nil, fmt.Errorf("source '%s' is %s, only failed sources can be retried", id, source.Status)
+		}
+		sources = append(sources, *source)
+	}
+	return sources, nil
 }
 
 func (e *Export) getExportWithUser(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger) *models.ExportPayload {
@@ -350,7 +730,15 @@ func DBExportToAPI(payload models.ExportPayload) ExportPayload {
 		Expires:     payload.Expires,
 		Name:        payload.Name,
 		Format:      string(payload.Format),
+		Archive:     string(payload.Archive),
 		Status:      string(payload.Status),
+		CallbackURL: payload.CallbackURL,
+	}
+	if payload.Encryption.Type != "" {
+		apiPayload.Encryption = &Encryption{Type: string(payload.Encryption.Type)}
+		if payload.Encryption.Type != models.PasswordEncryption {
+			apiPayload.Encryption.PublicKey = payload.Encryption.Key
+		}
 	}
 	for _, source := range payload.Sources {
 		// Normalize legacy "success" status to spec-compliant "complete".
@@ -366,6 +754,7 @@ func DBExportToAPI(payload models.ExportPayload) ExportPayload {
 			Status:      sourceStatus,
 			Resource:    source.Resource,
 			Filters:     source.Filters,
+			Format:      string(source.Format),
 		}
 
 		if source.SourceError != nil {
@@ -387,13 +776,8 @@ func APIExportToDBExport(apiPayload ExportPayload) (*models.ExportPayload, error
 	var sources []models.Source
 	for _, source := range apiPayload.Sources {
 
-		if source.Filters != nil {
-			var dst map[string]interface{}
-			// Verify the incoming filters are valid json
-			err := json.Unmarshal(source.Filters, &dst)
-			if err != nil {
-				return nil, fmt.Errorf("invalid json format of filters")
-			}
+		if err := verifyFilters(source.Filters); err != nil {
+			return nil, err
 		}
 
 		sources = append(sources, models.Source{
@@ -410,14 +794,54 @@ func APIExportToDBExport(apiPayload ExportPayload) (*models.ExportPayload, error
 		payload.Expires = apiPayload.Expires
 	}
 
-	switch apiPayload.Format {
-	case "csv":
-		payload.Format = models.CSV
-	case "json":
-		payload.Format = models.JSON
-	default:
-		return nil, fmt.Errorf("invalid or missing payload format")
+	format, err := parseFormat(apiPayload.Format)
+	if err != nil {
+		return nil, err
+	}
+	payload.Format = format
+
+	archive, err := parseArchive(apiPayload.Archive)
+	if err != nil {
+		return nil, err
+	}
+	payload.Archive = archive
+
+	if apiPayload.Encryption != nil {
+		payload.Encryption = models.Encryption{
+			Type: models.EncryptionType(apiPayload.Encryption.Type),
+			Key:  apiPayload.Encryption.PublicKey,
+		}
+		if payload.Encryption.Type == models.PasswordEncryption {
+			payload.Encryption.Key = apiPayload.Encryption.Password
+		}
+		if err := es3.VerifyEncryption(payload.Encryption, payload.Archive); err != nil {
+			return nil, err
+		}
+		if payload.Encryption.Type == models.PasswordEncryption {
+			// the password is not stored, only the keys of the files of the
+			// archive which are derived from it, wrapped until the export is
+			// finished
+			keys, err := es3.DeriveZipKeys(payload.Encryption.Key, len(payload.Sources))
+			if err != nil {
+				return nil, err
+			}
+			wrapped, err := es3.WrapZipKeys(config.Get().ArchiveConfig.PasswordKey, keys)
+			if err != nil {
+				return nil, err
+			}
+			payload.Encryption.Key = wrapped
+		}
+	}
+
+	if apiPayload.CallbackURL != "" {
+		if err := verifyCallbackURL(apiPayload.CallbackURL, config.Get().WebhookConfig.AllowedHosts); err != nil {
+			return nil, err
+		}
+	} else if apiPayload.CallbackSecret != "" {
+		return nil, fmt.Errorf("callback_secret requires a callback_url")
 	}
+	payload.CallbackURL = apiPayload.CallbackURL
+	payload.CallbackSecret = apiPayload.CallbackSecret
 
 	switch apiPayload.Status {
 	case "complete":
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"github.com/redhatinsights/export-service-go/config"
+)
+
+// schemaErrorPrinter formats the messages of filters that do not match their
+// schema.
+var schemaErrorPrinter = message.NewPrinter(language.English)
+
+// FieldError describes why a field of a request is invalid. Field is a JSON
+// pointer to the field in the body of the request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validateFilters validates the filters of every source against the filter
+// schema of its resource, if it has one. Missing filters are validated as an
+// empty object, so that a schema can require filters. The sources have to be
+// verified with verifyExportableApplication first.
+func validateFilters(resources map[string]map[string]config.ExportableResource, sources []Source) []FieldError {
+	var fieldErrors []FieldError
+	for i, source := range sources {
+		schema := resources[source.Application][source.Resource].Schema
+		if schema == nil {
+			continue
+		}
+		field := fmt.Sprintf("/sources/%d/filters", i)
+
+		var filters any = map[string]any{}
+		if len(source.Filters) > 0 {
+			var err error
+			if filters, err = jsonschema.UnmarshalJSON(bytes.NewReader(source.Filters)); err != nil {
+				fieldErrors = append(fieldErrors, FieldError{Field: field, Message: "invalid json format of filters"})
+				continue
+			}
+		}
+
+		err := schema.Validate(filters)
+		var validationErr *jsonschema.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			fieldErrors = append(fieldErrors, schemaFieldErrors(field, validationErr)...)
+		case err != nil:
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Message: err.Error()})
+		}
+	}
+	return fieldErrors
+}
+
+// schemaFieldErrors returns the errors of the fields below field which caused
+// the validation error.
+func schemaFieldErrors(field string, validationErr *jsonschema.ValidationError) []FieldError {
+	if len(validationErr.Causes) == 0 {
+		return []FieldError{{
+			Field:   field + jsonPointer(validationErr.InstanceLocation),
+			Message: validationErr.ErrorKind.LocalizedString(schemaErrorPrinter),
+		}}
+	}
+
+	var fieldErrors []FieldError
+	for _, cause := range validationErr.Causes {
+		fieldErrors = append(fieldErrors, schemaFieldErrors(field, cause)...)
+	}
+	return fieldErrors
+}
+
+// jsonPointer returns the JSON pointer to the value at the given path.
+func jsonPointer(path []string) string {
+	var sb strings.Builder
+	for _, token := range path {
+		sb.WriteByte('/')
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return sb.String()
+}
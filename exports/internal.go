@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	chi "github.com/go-chi/chi/v5"
 	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
@@ -88,6 +89,12 @@ func (i *Internal) PostError(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if payload.Status == models.Cancelled {
+		logger.Infow("received a late error for a cancelled export")
+		GoneError(w, fmt.Sprintf("export '%s' has been cancelled", params.ExportUUID))
+		return
+	}
+
 	_, source, err := payload.GetSource(params.ResourceUUID)
 	if err != nil {
 		logger.Errorw("failed to get source: %w", err)
@@ -102,6 +109,22 @@ func (i *Internal) PostError(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if i.retrySource(logger, payload, source, modelError) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := payload.SetStatusRunning(i.DB); errors.Is(err, models.ErrAlreadyFinished) {
+		// the export was cancelled after it was looked up
+		logger.Infow("received a late error for a finished export")
+		GoneError(w, fmt.Sprintf("export '%s' has already finished", params.ExportUUID))
+		return
+	} else if err != nil {
+		logger.Errorw("failed to save status update for failed export", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
 	w.WriteHeader(http.StatusAccepted)
 
 	if err := payload.SetSourceStatus(i.DB, params.ResourceUUID, models.RFailed, &modelError); err != nil {
@@ -110,12 +133,36 @@ func (i *Internal) PostError(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := payload.SetStatusRunning(i.DB); err != nil {
-		logger.Errorw("failed to save status update for failed export", "error", err)
-		InternalServerError(w, err)
+	i.Compressor.ProcessSources(i.DB, params.ExportUUID)
+}
+
+// retrySource requests a failed source from its application again if the retry
+// policy of the application allows it. The source then stays pending, and the
+// retry is recorded so that the Scheduler requests it once the backoff has
+// passed. It reports whether the source is being retried.
+func (i *Internal) retrySource(logger *zap.SugaredLogger, payload *models.ExportPayload, source *models.Source, sourceError models.SourceError) bool {
+	policy, ok := i.Cfg.RetryPolicies[source.Application]
+	if !ok || payload.Identity == "" {
+		return false
+	}
+	if !policy.Retries(sourceError.Code, source.Attempts) {
+		logger.Infow("not retrying failed source", "source", source.ID, "attempts", source.Attempts, "code", sourceError.Code)
+		return false
 	}
 
-	i.Compressor.ProcessSources(i.DB, params.ExportUUID)
+	delay := policy.Delay(source.Attempts)
+	if err := payload.ScheduleSourceRetry(i.DB, source.ID, time.Now().Add(delay)); err != nil {
+		logger.Errorw("failed to record retry of source", "error", err)
+		return false
+	}
+
+	logger.Infow("retrying failed source",
+		"source", source.ID,
+		"attempt", source.Attempts+1,
+		"code", sourceError.Code,
+		"message", sourceError.Message,
+		"delay", delay)
+	return true
 }
 
 // PostUpload receives a POST request from the export source containing
@@ -150,6 +197,12 @@ func (i *Internal) PostUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if payload.Status == models.Cancelled {
+		logger.Infow("received a late upload for a cancelled export")
+		GoneError(w, fmt.Sprintf("export '%s' has been cancelled", params.ExportUUID))
+		return
+	}
+
 	_, source, err := payload.GetSource(params.ResourceUUID)
 	if err != nil {
 		logger.Errorf("failed to get source: %w", err)
@@ -169,6 +222,12 @@ func (i *Internal) PostUpload(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSizeBytes)
 
 	if err := i.Compressor.CreateObject(r.Context(), logger, i.DB, r.Body, params.Application, params.ResourceUUID, payload); err != nil {
+		if errors.Is(err, models.ErrAlreadyFinished) {
+			// the export was cancelled after it was looked up
+			logger.Infow("received a late upload for a finished export")
+			GoneError(w, fmt.Sprintf("export '%s' has already finished", params.ExportUUID))
+			return
+		}
 		if errors.As(err, &maxBytesError) {
 			w.WriteHeader(http.StatusRequestEntityTooLarge)
 			Logerr(fmt.Fprintf(w, "payload is too large, max size: %dMB", i.Cfg.MaxPayloadSize))
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"time"
 
 	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/redhatinsights/platform-go-middlewares/v2/identity"
@@ -20,13 +23,11 @@ import (
 	emiddleware "github.com/redhatinsights/export-service-go/middleware"
 	"github.com/redhatinsights/export-service-go/models"
 	es3 "github.com/redhatinsights/export-service-go/s3"
-	"golang.org/x/time/rate"
 )
 
 var _ = Context("Set up internal handler", func() {
 	cfg := config.Get()
 	log := logger.Get()
-	rateLimiter := rate.NewLimiter(rate.Limit(cfg.RateLimitConfig.Rate), cfg.RateLimitConfig.Burst)
 
 	var internalHandler *exports.Internal
 	var router *chi.Mux
@@ -42,13 +43,17 @@ var _ = Context("Set up internal handler", func() {
 		mockKafkaCall := func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload) {
 		}
 
+		mockCancelCall := func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload, sources []models.Source) {
+		}
+
 		exportHandler := &exports.Export{
-			Bucket:              "cfg.StorageConfig.Bucket",
-			StorageHandler:      &es3.MockStorageHandler{},
-			DB:                  &models.ExportDB{DB: testGormDB, Cfg: cfg},
-			RequestAppResources: mockKafkaCall,
-			Log:                 log,
-			RateLimiter:         rateLimiter,
+			Bucket:                "cfg.StorageConfig.Bucket",
+			StorageHandler:        &es3.MockStorageHandler{},
+			DB:                    &models.ExportDB{DB: testGormDB, Cfg: cfg},
+			RequestAppResources:   mockKafkaCall,
+			CancelAppResources:    mockCancelCall,
+			PublishLifecycleEvent: mockPublishLifecycleEvent,
+			Log:                   log,
 		}
 
 		router = chi.NewRouter()
@@ -68,6 +73,7 @@ var _ = Context("Set up internal handler", func() {
 			sub.Get("/exports/{exportUUID}/status", exportHandler.GetExportStatus)
 			sub.Delete("/exports/{exportUUID}", exportHandler.DeleteExport)
 			sub.Get("/exports/{exportUUID}", exportHandler.GetExport)
+			sub.Post("/exports/{exportUUID}/cancel", exportHandler.CancelExport)
 		})
 	})
 
@@ -163,6 +169,221 @@ var _ = Context("Set up internal handler", func() {
 			Expect(source["error"].(float64)).To(Equal(123.0))
 		})
 
+		DescribeTable("rejects late calls for a cancelled export", func(endpoint, body string) {
+			rr := httptest.NewRecorder()
+
+			req := createExportRequest("testRequest", "json", "", `{"application":"exampleApp", "resource":"exampleResource"}`)
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusAccepted))
+
+			var exportResponse map[string]interface{}
+			err := json.Unmarshal(rr.Body.Bytes(), &exportResponse)
+			Expect(err).ShouldNot(HaveOccurred())
+			exportUUID := exportResponse["id"].(string)
+			sources := exportResponse["sources"].([]interface{})
+			source := sources[0].(map[string]interface{})
+			resourceUUID := source["id"].(string)
+
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("POST", fmt.Sprintf("/api/export/v1/exports/%s/cancel", exportUUID), nil)
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("POST", fmt.Sprintf("/app/export/v1/%s/%s/exampleApp/%s", endpoint, exportUUID, resourceUUID), bytes.NewBuffer([]byte(body)))
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusGone))
+			Expect(rr.Body.String()).To(ContainSubstring("has been cancelled"))
+
+			// the export stays cancelled
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", fmt.Sprintf("/api/export/v1/exports/%s/status", exportUUID), nil)
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring(`"status":"cancelled"`))
+		},
+			Entry("upload", "upload", `{"data": "dummy data"}`),
+			Entry("error", "error", `{"message": "test error", "error": 123}`),
+		)
+
+		DescribeTable("rejects calls for an export which is cancelled while they are handled", func(endpoint, body string) {
+			rr := httptest.NewRecorder()
+
+			req := createExportRequest("testRequest", "json", "", `{"application":"exampleApp", "resource":"exampleResource"}`)
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusAccepted))
+
+			var exportResponse map[string]interface{}
+			err := json.Unmarshal(rr.Body.Bytes(), &exportResponse)
+			Expect(err).ShouldNot(HaveOccurred())
+			exportUUID := exportResponse["id"].(string)
+			sources := exportResponse["sources"].([]interface{})
+			source := sources[0].(map[string]interface{})
+			resourceUUID := source["id"].(string)
+
+			internalHandler.DB = cancellingDB{&models.ExportDB{DB: testGormDB, Cfg: cfg}}
+
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("POST", fmt.Sprintf("/app/export/v1/%s/%s/exampleApp/%s", endpoint, exportUUID, resourceUUID), bytes.NewBuffer([]byte(body)))
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusGone))
+			Expect(rr.Body.String()).To(ContainSubstring("has already finished"))
+
+			// the export stays cancelled
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", fmt.Sprintf("/api/export/v1/exports/%s/status", exportUUID), nil)
+			AddDebugUserIdentity(req)
+			router.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring(`"status":"cancelled"`))
+		},
+			Entry("upload", "upload", `{"data": "dummy data"}`),
+			Entry("error", "error", `{"message": "test error", "error": 123}`),
+		)
+
+		Describe("with a retry policy", func() {
+			var retried []models.ExportPayload
+			var scheduler *exports.Scheduler
+
+			BeforeEach(func() {
+				cfg.RetryPolicies = map[string]config.RetryPolicy{
+					"exampleApp": {MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, ErrorCodes: []int{503}},
+				}
+				DeferCleanup(func() { cfg.RetryPolicies = nil })
+
+				retried = nil
+				scheduler = &exports.Scheduler{
+					DB:         &models.ExportDB{DB: testGormDB, Cfg: cfg},
+					Log:        log,
+					RetryLease: time.Hour,
+					RequestAppResources: func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload) {
+						retried = append(retried, payload)
+					},
+				}
+			})
+
+			// retryDue runs the retries which are due, after waiting out the backoff
+			retryDue := func() int {
+				time.Sleep(10 * time.Millisecond)
+				return scheduler.RetryDue(context.Background())
+			}
+
+			// createExport creates an export and returns the ids of the export and its source
+			createExport := func() (string, string) {
+				rr := httptest.NewRecorder()
+				req := createExportRequest("testRequest", "json", "", `{"application":"exampleApp", "resource":"exampleResource"}`)
+				AddDebugUserIdentity(req)
+				router.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusAccepted))
+
+				var exportResponse exports.ExportPayload
+				err := json.Unmarshal(rr.Body.Bytes(), &exportResponse)
+				Expect(err).ShouldNot(HaveOccurred())
+				return exportResponse.ID, exportResponse.Sources[0].ID.String()
+			}
+
+			postError := func(exportUUID, resourceUUID string, code int) {
+				rr := httptest.NewRecorder()
+				errorBody := fmt.Sprintf(`{"message": "test error", "error": %d}`, code)
+				req := httptest.NewRequest("POST", fmt.Sprintf("/app/export/v1/error/%s/exampleApp/%s", exportUUID, resourceUUID), bytes.NewBuffer([]byte(errorBody)))
+				AddDebugUserIdentity(req)
+				router.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusAccepted))
+			}
+
+			getStatus := func(exportUUID string) exports.ExportPayload {
+				rr := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", fmt.Sprintf("/api/export/v1/exports/%s/status", exportUUID), nil)
+				AddDebugUserIdentity(req)
+				router.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				var exportResponse exports.ExportPayload
+				err := json.Unmarshal(rr.Body.Bytes(), &exportResponse)
+				Expect(err).ShouldNot(HaveOccurred())
+				return exportResponse
+			}
+
+			It("requests the source again until the attempts run out", func() {
+				exportUUID, resourceUUID := createExport()
+
+				postError(exportUUID, resourceUUID, 503)
+
+				// the retry is recorded, and only sent by a scheduler
+				Expect(retried).To(BeEmpty())
+				Expect(retryDue()).To(Equal(1))
+				Expect(retried).To(HaveLen(1))
+				payload := retried[0]
+				Expect(payload.ID.String()).To(Equal(exportUUID))
+				Expect(payload.Identity).ToNot(BeEmpty())
+				Expect(payload.Sources).To(HaveLen(1))
+				Expect(payload.Sources[0].ID.String()).To(Equal(resourceUUID))
+				Expect(payload.Sources[0].Attempts).To(Equal(2))
+
+				// each retry is only sent once
+				Expect(retryDue()).To(Equal(0))
+
+				exportResponse := getStatus(exportUUID)
+				Expect(exportResponse.Status).To(Equal("pending"))
+				Expect(exportResponse.Sources[0].Status).To(Equal("pending"))
+
+				postError(exportUUID, resourceUUID, 503)
+
+				Expect(retryDue()).To(Equal(0))
+				exportResponse = getStatus(exportUUID)
+				Expect(exportResponse.Status).To(Equal("failed"))
+				Expect(exportResponse.Sources[0].Status).To(Equal("failed"))
+				Expect(exportResponse.Sources[0].Code).To(Equal(503))
+			})
+
+			It("sends retries again which are not answered within their lease", func() {
+				exportUUID, resourceUUID := createExport()
+
+				postError(exportUUID, resourceUUID, 503)
+
+				// the request is lost, so the application never answers
+				scheduler.RetryLease = time.Millisecond
+				Expect(retryDue()).To(Equal(1))
+				Expect(retryDue()).To(Equal(1))
+				Expect(retried).To(HaveLen(2))
+
+				// the answer of the application ends the lease
+				postError(exportUUID, resourceUUID, 503)
+				Expect(retryDue()).To(Equal(0))
+				Expect(getStatus(exportUUID).Status).To(Equal("failed"))
+			})
+
+			It("does not retry errors outside of the policy", func() {
+				exportUUID, resourceUUID := createExport()
+
+				postError(exportUUID, resourceUUID, 400)
+
+				Expect(retryDue()).To(Equal(0))
+				Expect(getStatus(exportUUID).Status).To(Equal("failed"))
+			})
+
+			It("does not retry sources of cancelled exports", func() {
+				exportUUID, resourceUUID := createExport()
+
+				postError(exportUUID, resourceUUID, 503)
+
+				rr := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", fmt.Sprintf("/api/export/v1/exports/%s/cancel", exportUUID), nil)
+				AddDebugUserIdentity(req)
+				router.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusOK))
+
+				Expect(retryDue()).To(Equal(0))
+				Expect(retried).To(BeEmpty())
+			})
+		})
+
 		It("Returns a 400 error when the user's error is missing a required field", func() {
 			rr := httptest.NewRecorder()
 
@@ -277,3 +498,20 @@ var _ = Context("Set up internal handler", func() {
 		})
 	})
 })
+
+// cancellingDB cancels every export right after it is looked up, as if the
+// export was cancelled while a request for it is handled.
+type cancellingDB struct {
+	*models.ExportDB
+}
+
+func (db cancellingDB) Get(exportUUID uuid.UUID) (*models.ExportPayload, error) {
+	payload, err := db.ExportDB.Get(exportUUID)
+	if err != nil {
+		return nil, err
+	}
+	cancelled := *payload
+	cancelled.Sources = slices.Clone(payload.Sources)
+	Expect(db.Cancel(&cancelled)).To(Succeed())
+	return payload, nil
+}
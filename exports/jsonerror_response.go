@@ -16,6 +16,8 @@ var log = logger.Get()
 type Error struct {
 	Msg  interface{} `json:"message"`
 	Code int         `json:"code"`
+	// Errors lists the invalid fields of the request, if any
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
 // Logerr is a wrapper function to log errors (as warning) from (http.ResponseWriter).Write
@@ -39,16 +41,50 @@ func BadRequestError(w http.ResponseWriter, err interface{}) {
 	JSONError(w, err, http.StatusBadRequest)
 }
 
+// FieldsError returns a 400 json response listing the invalid fields
+func FieldsError(w http.ResponseWriter, err interface{}, fieldErrors []FieldError) {
+	e := Error{Msg: err, Code: http.StatusBadRequest, Errors: fieldErrors}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
 // InternalServerError returns a 500 json response
 func InternalServerError(w http.ResponseWriter, err interface{}) {
 	JSONError(w, err, http.StatusInternalServerError)
 }
 
+// ForbiddenError returns a 403 json response
+func ForbiddenError(w http.ResponseWriter, err interface{}) {
+	JSONError(w, err, http.StatusForbidden)
+}
+
 // NotFoundError returns a 404 json response
 func NotFoundError(w http.ResponseWriter, err interface{}) {
 	JSONError(w, err, http.StatusNotFound)
 }
 
+// ConflictError returns a 409 json response
+func ConflictError(w http.ResponseWriter, err interface{}) {
+	JSONError(w, err, http.StatusConflict)
+}
+
+// GoneError returns a 410 json response
+func GoneError(w http.ResponseWriter, err interface{}) {
+	JSONError(w, err, http.StatusGone)
+}
+
+// UnprocessableEntityError returns a 422 json response
+func UnprocessableEntityError(w http.ResponseWriter, err interface{}) {
+	JSONError(w, err, http.StatusUnprocessableEntity)
+}
+
+// TooManyRequestsError returns a 429 json response
+func TooManyRequestsError(w http.ResponseWriter, err interface{}) {
+	JSONError(w, err, http.StatusTooManyRequests)
+}
+
 // NotImplementedError returns a 501 json response
 func NotImplementedError(w http.ResponseWriter) {
 	JSONError(w, "not implemented", http.StatusNotImplemented)
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	ekafka "github.com/redhatinsights/export-service-go/kafka"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// The events in the lifecycle of an export. The type of the published cloud
+// event is KAFKA_EVENT_LIFECYCLE_TYPE followed by a dot and the event.
+const (
+	ExportCreated   = "created"
+	ExportCompleted = "completed"
+	ExportPartial   = "partial"
+	ExportFailed    = "failed"
+	ExportExpiring  = "expiring"
+	ExportDeleted   = "deleted"
+)
+
+// lifecycleApplication is the application header of lifecycle events, which
+// are about the export as a whole rather than one of its sources.
+const lifecycleApplication = "export-service"
+
+// PublishLifecycleEvent tells the platform that an export went through one of
+// the events of its lifecycle, e.g. so that the user can be notified.
+type PublishLifecycleEvent func(log *zap.SugaredLogger, event string, payload models.ExportPayload)
+
+// KafkaPublishLifecycleEvent publishes lifecycle events to the lifecycle topic.
+// Nothing is published if no topic is configured.
+func KafkaPublishLifecycleEvent(kafkaChan chan *kafka.Message) PublishLifecycleEvent {
+	return func(log *zap.SugaredLogger, event string, payload models.ExportPayload) {
+		msg, err := NewLifecycleMessage(event, payload)
+		if err != nil {
+			log.Errorw("failed to create kafka lifecycle message", "event", event, "error", err)
+			return
+		}
+		if msg == nil {
+			return
+		}
+
+		kafkaChan <- msg
+		log.Infow("sent kafka lifecycle message to the producer", "event", event)
+	}
+}
+
+// NewLifecycleMessage returns the message of a lifecycle event of the export,
+// or nil if no lifecycle topic is configured.
+func NewLifecycleMessage(event string, payload models.ExportPayload) (*kafka.Message, error) {
+	kafkaConfig := config.Get().KafkaConfig
+	if kafkaConfig.LifecycleTopic == "" {
+		return nil, nil
+	}
+
+	// the identity of the user is not forwarded, the events only carry
+	// what the export is and whom it belongs to
+	headers := ekafka.KafkaHeader{
+		Application: lifecycleApplication,
+	}
+	kpayload := newKafkaMessage(kafkaConfig.EventLifecycleType+"."+event, kafkaConfig.EventLifecycleDataSchema, payload)
+	kpayload.Data = newExportLifecycle(event, payload)
+
+	return kpayload.ToMessage(headers, kafkaConfig.LifecycleTopic)
+}
+
+func newExportLifecycle(event string, payload models.ExportPayload) ekafka.ExportLifecycle {
+	data := ekafka.ExportLifecycleClass{
+		Event:             event,
+		ExportRequestUUID: payload.ID.String(),
+		Name:              payload.Name,
+		Format:            string(payload.Format),
+		Status:            string(payload.Status),
+		CreatedAt:         payload.CreatedAt.UTC().Format(formatDateTime),
+		AccountID:         payload.AccountID,
+		Username:          payload.Username,
+	}
+	if len(payload.Sources) > 0 {
+		data.Applications = applicationNames(payload.Sources)
+	}
+	if payload.CompletedAt != nil {
+		data.CompletedAt = payload.CompletedAt.UTC().Format(formatDateTime)
+	}
+	if payload.Expires != nil {
+		data.ExpiresAt = payload.Expires.UTC().Format(formatDateTime)
+	}
+	return ekafka.ExportLifecycle{ExportLifecycle: data}
+}
+
+// finishedEvent returns the lifecycle event of an export that reached the
+// given status, if the status is final.
+func finishedEvent(status models.PayloadStatus) (string, bool) {
+	switch status {
+	case models.Complete:
+		return ExportCompleted, true
+	case models.Partial:
+		return ExportPartial, true
+	case models.Failed:
+		return ExportFailed, true
+	default:
+		return "", false
+	}
+}
+
+// LifecycleNotifier publishes the lifecycle event of every export that is
+// finished by the compressor.
+type LifecycleNotifier struct {
+	DB                    models.DBInterface
+	Log                   *zap.SugaredLogger
+	PublishLifecycleEvent PublishLifecycleEvent
+}
+
+func (ln *LifecycleNotifier) ExportFinished(exportID uuid.UUID) {
+	logger := ln.Log.With(export_logger.ExportIDField(exportID.String()))
+
+	payload, err := ln.DB.Get(exportID)
+	if err != nil {
+		logger.Errorw("failed to get finished export", "error", err)
+		return
+	}
+
+	event, ok := finishedEvent(payload.Status)
+	if !ok {
+		logger.Warnw("finished export has no final status", "status", payload.Status)
+		return
+	}
+	ln.PublishLifecycleEvent(logger, event, *payload)
+}
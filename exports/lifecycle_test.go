@@ -0,0 +1,80 @@
+package exports_test
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/exports"
+	ekafka "github.com/redhatinsights/export-service-go/kafka"
+	"github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+var _ = Describe("Lifecycle events", func() {
+	It("are published to the lifecycle topic as cloud events", func() {
+		kafkaConfig := config.Get().KafkaConfig
+		kafkaChan := make(chan *kafka.Message, 1)
+		publish := exports.KafkaPublishLifecycleEvent(kafkaChan)
+
+		router := setupTest(mockRequestApplicationResources)
+		exportUUID := createTestExport(router)
+		markExportComplete(exportUUID)
+
+		payload, err := (&models.ExportDB{DB: testGormDB, Cfg: config.Get()}).Get(uuid.MustParse(exportUUID))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		publish(logger.Get(), exports.ExportCompleted, *payload)
+
+		var msg *kafka.Message
+		Expect(kafkaChan).To(Receive(&msg))
+		Expect(*msg.TopicPartition.Topic).To(Equal(kafkaConfig.LifecycleTopic))
+
+		var event struct {
+			ekafka.KafkaMessage
+			Data ekafka.ExportLifecycle `json:"data"`
+		}
+		err = json.Unmarshal(msg.Value, &event)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(event.Type).To(Equal(kafkaConfig.EventLifecycleType + ".completed"))
+		Expect(event.DataSchema).To(Equal(kafkaConfig.EventLifecycleDataSchema))
+		Expect(event.OrgID).To(Equal(payload.OrganizationID))
+
+		data := event.Data.ExportLifecycle
+		Expect(data.Event).To(Equal(exports.ExportCompleted))
+		Expect(data.ExportRequestUUID).To(Equal(exportUUID))
+		Expect(data.Status).To(Equal("complete"))
+		Expect(data.Username).To(Equal(payload.Username))
+		Expect(data.Applications).To(Equal([]string{"exampleApp"}))
+		Expect(data.ExpiresAt).ToNot(BeEmpty())
+	})
+
+	DescribeTable("are published for every finished export", func(status models.PayloadStatus, expectedEvent string) {
+		router := setupTest(mockRequestApplicationResources)
+		exportUUID := uuid.MustParse(createTestExport(router))
+		testGormDB.Exec("UPDATE export_payloads SET status = ? WHERE id = ?", status, exportUUID)
+		publishedLifecycleEvents = nil
+
+		notifier := &exports.LifecycleNotifier{
+			DB:                    &models.ExportDB{DB: testGormDB, Cfg: config.Get()},
+			Log:                   logger.Get(),
+			PublishLifecycleEvent: mockPublishLifecycleEvent,
+		}
+		notifier.ExportFinished(exportUUID)
+
+		if expectedEvent == "" {
+			Expect(publishedLifecycleEvents).To(BeEmpty())
+			return
+		}
+		Expect(publishedLifecycleEvents).To(ConsistOf(lifecycleEvent{Event: expectedEvent, ExportID: exportUUID}))
+	},
+		Entry("when it is complete", models.Complete, exports.ExportCompleted),
+		Entry("when it is partial", models.Partial, exports.ExportPartial),
+		Entry("when it failed", models.Failed, exports.ExportFailed),
+		Entry("but not while it is running", models.Running, ""),
+	)
+})
@@ -0,0 +1,56 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// quotaWindow is the period over which the daily quota is counted.
+const quotaWindow = 24 * time.Hour
+
+// quotaError is returned when an organization may not create another export.
+// Too many exports in flight or created within the window are temporary, and
+// answered with a 429. Stored archives only go away when exports expire or are
+// deleted, so exceeding the storage quota is answered with a 403.
+type quotaError struct {
+	code int
+	msg  string
+}
+
+func (e *quotaError) Error() string {
+	return e.msg
+}
+
+// checkQuota returns a quotaError if the organization may not create another
+// export. It is only called when a new export is about to be created, so that
+// replayed requests are not refused, with the transaction of
+// ExportDB.CreateAllowed, so that concurrent requests can not exceed the quota.
+func checkQuota(db models.DBInterface, orgID string) error {
+	quota := config.Get().QuotaFor(orgID)
+	if quota == (config.Quota{}) {
+		return nil
+	}
+
+	usage, err := db.GetOrgUsage(orgID, time.Now().Add(-quotaWindow))
+	if err != nil {
+		return fmt.Errorf("failed to get organization usage: %w", err)
+	}
+
+	switch {
+	case quota.MaxInFlight > 0 && usage.InFlight >= quota.MaxInFlight:
+		return &quotaError{http.StatusTooManyRequests, fmt.Sprintf("organization has %d exports in progress, the limit is %d; wait for them to finish before creating another export", usage.InFlight, quota.MaxInFlight)}
+	case quota.MaxDaily > 0 && usage.Created >= quota.MaxDaily:
+		return &quotaError{http.StatusTooManyRequests, fmt.Sprintf("organization created %d exports in the last 24 hours, the limit is %d", usage.Created, quota.MaxDaily)}
+	case quota.MaxStoredBytes > 0 && usage.StoredBytes >= quota.MaxStoredBytes:
+		return &quotaError{http.StatusForbidden, fmt.Sprintf("organization stores %d bytes of exports, the limit is %d bytes; delete exports to create new ones", usage.StoredBytes, quota.MaxStoredBytes)}
+	}
+	return nil
+}
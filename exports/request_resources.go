@@ -7,6 +7,7 @@ package exports
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
@@ -20,15 +21,38 @@ import (
 	"github.com/redhatinsights/export-service-go/models"
 )
 
+// newKafkaMessage builds the cloud event envelope shared by every message sent
+// to the source applications about the given export.
+func newKafkaMessage(eventType, dataSchema string, payload models.ExportPayload) ekafka.KafkaMessage {
+	kafkaConfig := config.Get().KafkaConfig
+	return ekafka.KafkaMessage{
+		ID:          uuid.New(),
+		Schema:      kafkaConfig.EventSchema,
+		Source:      kafkaConfig.EventSource,
+		Subject:     fmt.Sprintf("urn:redhat:subject:export-service:request:%s", payload.ID.String()),
+		SpecVersion: kafkaConfig.EventSpecVersion,
+		Type:        eventType,
+		Time:        time.Now().UTC().Format(formatDateTime),
+		OrgID:       payload.OrganizationID,
+		DataSchema:  dataSchema,
+	}
+}
+
 type RequestApplicationResources func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload)
 
-func KafkaRequestApplicationResources(kafkaChan chan *kafka.Message) RequestApplicationResources {
+// KafkaRequestApplicationResources sends the requests for the sources of an
+// export to the producer in the background. sending tracks them, so that
+// kafkaChan is only closed once every request has been sent.
+func KafkaRequestApplicationResources(kafkaChan chan *kafka.Message, sending *sync.WaitGroup) RequestApplicationResources {
 	kafkaConfig := config.Get().KafkaConfig
 	// sendPayload converts the individual sources of a payload into
 	// kafka messages which are then sent to the producer through the
 	// `messagesChan`
 	return func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload) {
+		sending.Add(1)
 		go func() {
+			defer sending.Done()
+
 			sources, err := payload.GetSources()
 			if err != nil {
 				log.Errorw("failed unmarshalling sources", "error", err)
@@ -47,7 +71,7 @@ func KafkaRequestApplicationResources(kafkaChan chan *kafka.Message) RequestAppl
 					}
 				}
 
-				format, ok := ekafka.ParseFormat(string(payload.Format))
+				format, ok := ekafka.ParseFormat(string(source.Format))
 				if !ok {
 					log.Errorw("failed parsing format", "error", err)
 					// FIXME:
@@ -59,26 +83,16 @@ func KafkaRequestApplicationResources(kafkaChan chan *kafka.Message) RequestAppl
 					Application: source.Application,
 					IDheader:    identity,
 				}
-				kpayload := ekafka.KafkaMessage{
-					ID:          uuid.New(),
-					Schema:      kafkaConfig.EventSchema,
-					Source:      kafkaConfig.EventSource,
-					Subject:     fmt.Sprintf("urn:redhat:subject:export-service:request:%s", payload.ID.String()),
-					SpecVersion: kafkaConfig.EventSpecVersion,
-					Type:        kafkaConfig.EventType,
-					Time:        time.Now().UTC().Format(formatDateTime),
-					OrgID:       payload.OrganizationID,
-					DataSchema:  kafkaConfig.EventDataSchema,
-					Data: cloudEventSchema.ResourceRequest{
-						ResourceRequest: cloudEventSchema.ResourceRequestClass{
-							Application:       source.Application,
-							ExportRequestUUID: payload.ID.String(),
-							Filters:           filters,
-							Format:            format,
-							Resource:          source.Resource,
-							UUID:              source.ID.String(),
-							XRhIdentity:       identity,
-						},
+				kpayload := newKafkaMessage(kafkaConfig.EventType, kafkaConfig.EventDataSchema, payload)
+				kpayload.Data = cloudEventSchema.ResourceRequest{
+					ResourceRequest: cloudEventSchema.ResourceRequestClass{
+						Application:       source.Application,
+						ExportRequestUUID: payload.ID.String(),
+						Filters:           filters,
+						Format:            format,
+						Resource:          source.Resource,
+						UUID:              source.ID.String(),
+						XRhIdentity:       identity,
 					},
 				}
 
@@ -97,3 +111,45 @@ func KafkaRequestApplicationResources(kafkaChan chan *kafka.Message) RequestAppl
 		}()
 	}
 }
+
+// CancelApplicationResources notifies the source applications that the given
+// sources of an export are no longer wanted.
+type CancelApplicationResources func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload, sources []models.Source)
+
+// KafkaCancelApplicationResources sends the cancellations to the producer in
+// the background, tracked by sending as for KafkaRequestApplicationResources.
+func KafkaCancelApplicationResources(kafkaChan chan *kafka.Message, sending *sync.WaitGroup) CancelApplicationResources {
+	kafkaConfig := config.Get().KafkaConfig
+	return func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload, sources []models.Source) {
+		sending.Add(1)
+		go func() {
+			defer sending.Done()
+
+			for _, source := range sources {
+				headers := ekafka.KafkaHeader{
+					Application: source.Application,
+					IDheader:    identity,
+				}
+				kpayload := newKafkaMessage(kafkaConfig.EventCancelType, kafkaConfig.EventCancelDataSchema, payload)
+				kpayload.Data = ekafka.ResourceCancellation{
+					ResourceCancellation: ekafka.ResourceCancellationClass{
+						Application:       source.Application,
+						ExportRequestUUID: payload.ID.String(),
+						Resource:          source.Resource,
+						UUID:              source.ID.String(),
+						XRhIdentity:       identity,
+					},
+				}
+
+				msg, err := kpayload.ToMessage(headers, kafkaConfig.ExportsTopic)
+				if err != nil {
+					log.Errorw("failed to create kafka cancellation message", "error", err)
+					continue
+				}
+
+				kafkaChan <- msg
+				log.Infof("sent kafka cancellation message to the producer: %+v", msg)
+			}
+		}()
+	}
+}
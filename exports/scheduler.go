@@ -0,0 +1,182 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// Scheduler creates an export whenever one of the export schedules is due,
+// and requests the sources whose automatic retry is due from their
+// applications again. Any number of schedulers can run against the same
+// database; each run of a schedule, and each retry, is claimed by exactly one
+// of them.
+type Scheduler struct {
+	DB                    models.DBInterface
+	Log                   *zap.SugaredLogger
+	RequestAppResources   RequestApplicationResources
+	PublishLifecycleEvent PublishLifecycleEvent
+	Interval              time.Duration
+	// RetryLease is how long a retry which was sent waits for the answer of
+	// its application before it is sent again
+	RetryLease time.Duration
+}
+
+// Start runs the due schedules every Interval until ctx is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if created := s.RunDue(ctx); created > 0 {
+			s.Log.Infow("created scheduled exports", "count", created)
+		}
+		if retried := s.RetryDue(ctx); retried > 0 {
+			s.Log.Infow("retried failed sources", "count", retried)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue creates an export for every schedule which is currently due, and
+// returns the number of exports created.
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	created := 0
+	for ctx.Err() == nil {
+		var export *models.ExportPayload
+		var identity string
+		found, err := s.DB.RunDueSchedule(time.Now(), func(tx *models.ExportDB, schedule *models.ExportSchedule) (err error) {
+			identity = schedule.Identity
+			export, err = s.run(tx, schedule)
+			return err
+		})
+		var runErr *models.ScheduleRunError
+		if errors.As(err, &runErr) {
+			// the schedule is backed off, the other due schedules still run
+			s.Log.Errorw("failed to run export schedule", "schedule_id", runErr.ScheduleID, "error", runErr.Err)
+			continue
+		}
+		if err != nil {
+			s.Log.Errorw("failed to find due export schedules", "error", err)
+			return created
+		}
+		if !found {
+			return created
+		}
+		if export == nil {
+			continue
+		}
+
+		created++
+		logger := s.Log.With(
+			export_logger.RequestIDField(export.RequestID),
+			export_logger.OrgIDField(export.OrganizationID),
+			export_logger.ExportIDField(export.ID.String()),
+			export_logger.ApplicationNamesField(applicationNames(export.Sources)),
+		)
+		logger.Infow("scheduled export created successfully", "export_name", export.Name)
+		s.PublishLifecycleEvent(logger, ExportCreated, *export)
+
+		// the sources are only requested once the export has been committed
+		s.RequestAppResources(ctx, logger, identity, *export)
+	}
+	return created
+}
+
+// RetryDue requests every source whose automatic retry is due from its
+// application again, and returns the number of sources requested. Retries are
+// therefore sent up to Interval after their backoff has passed. Retries which
+// are not answered within RetryLease, e.g. because the request was lost, are
+// sent again.
+func (s *Scheduler) RetryDue(ctx context.Context) int {
+	exports, err := s.DB.ClaimDueRetries(time.Now(), s.RetryLease)
+	if err != nil {
+		s.Log.Errorw("failed to claim due source retries", "error", err)
+		return 0
+	}
+
+	retried := 0
+	for _, export := range exports {
+		logger := s.Log.With(
+			export_logger.RequestIDField(export.RequestID),
+			export_logger.OrgIDField(export.OrganizationID),
+			export_logger.ExportIDField(export.ID.String()),
+			export_logger.ApplicationNamesField(applicationNames(export.Sources)),
+		)
+		logger.Infow("requesting failed sources again", "sources", len(export.Sources))
+		s.RequestAppResources(ctx, logger, export.Identity, export)
+		retried += len(export.Sources)
+	}
+	return retried
+}
+
+// run creates the export for a due schedule and advances it to its next run.
+// Runs which were missed while no scheduler was running are not caught up on,
+// the schedule simply runs once. No export is created if the definition no
+// longer matches the configured exports, or if the organization exceeds its
+// quota. Schedules whose identity expired are disabled instead of being run
+// with it.
+func (s *Scheduler) run(tx *models.ExportDB, schedule *models.ExportSchedule) (*models.ExportPayload, error) {
+	logger := s.Log.With(export_logger.OrgIDField(schedule.OrganizationID), "schedule_id", schedule.ID)
+	now := time.Now()
+
+	var export *models.ExportPayload
+	definition, err := tx.GetDefinition(schedule.DefinitionID, schedule.User)
+	switch {
+	case schedule.IdentityExpired(now):
+		logger.Warnw("disabling schedule whose identity expired, it has to be updated to run again", "identity_expires_at", schedule.IdentityExpiresAt)
+		schedule.Enabled = false
+	case err == models.ErrRecordNotFound:
+		logger.Warnw("disabling schedule whose definition no longer exists", "definition_id", schedule.DefinitionID)
+		schedule.Enabled = false
+	case err != nil:
+		return nil, err
+	case verifyExportableApplication(config.Get().ExportableApplications, definitionSources(definition.Sources)) != nil:
+		logger.Warnw("skipping scheduled export, definition does not match Configured Exports", "definition_id", definition.ID)
+	case verifyFormat(config.Get().ExportableResources, definition.Format, definitionSources(definition.Sources)) != nil:
+		logger.Warnw("skipping scheduled export, definition format is not supported by its sources", "definition_id", definition.ID)
+	case len(validateFilters(config.Get().ExportableResources, definitionSources(definition.Sources))) > 0:
+		logger.Warnw("skipping scheduled export, definition filters do not match their schema", "definition_id", definition.ID)
+	default:
+		export, _, err = newExport(tx, definition.NewExportPayload(), uuid.NewString(), schedule.Identity, schedule.User, "", func(tx *models.ExportDB) error {
+			return checkQuota(tx, schedule.OrganizationID)
+		})
+		var quotaErr *quotaError
+		switch {
+		case errors.As(err, &quotaErr):
+			logger.Warnw("skipping scheduled export, organization exceeds its quota", "error", err)
+		case err != nil:
+			return nil, err
+		default:
+			schedule.LastExportID = &export.ID
+		}
+	}
+
+	schedule.LastRunAt = &now
+	if err := schedule.Advance(now); err != nil {
+		logger.Warnw("disabling schedule with an invalid cron expression", "cron", schedule.Cron, "error", err)
+		schedule.Enabled = false
+		schedule.NextRunAt = nil
+	}
+
+	if err := tx.UpdateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/middleware"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// ScheduleRouter is a router for all of the external routes for the
+// /exports/schedules endpoint.
+func (e *Export) ScheduleRouter(r chi.Router) {
+	r.Post("/", e.PostSchedule)
+	r.With(middleware.PaginationCtx).Get("/", e.ListSchedules)
+	r.Route("/{scheduleUUID}", func(sub chi.Router) {
+		sub.Get("/", e.GetSchedule)
+		sub.Put("/", e.PutSchedule)
+		sub.Delete("/", e.DeleteSchedule)
+	})
+}
+
+// PostSchedule handles POST requests to the /exports/schedules endpoint.
+func (e *Export) PostSchedule(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	schedule := &models.ExportSchedule{User: mapUsertoModelUser(user)}
+	if !e.decodeSchedule(w, r, logger, schedule) {
+		return
+	}
+	schedule.SetIdentity(r.Header.Get("X-Rh-Identity"), config.Get().ScheduleIdentityTTL)
+
+	schedule, err := e.DB.CreateSchedule(schedule)
+	if err != nil {
+		logger.Errorw("error creating schedule entry", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Infow("export schedule created successfully", "schedule_id", schedule.ID, "definition_id", schedule.DefinitionID)
+
+	w.WriteHeader(http.StatusCreated)
+
+	apiSchedule := DBScheduleToAPI(*schedule)
+	if err := json.NewEncoder(w).Encode(&apiSchedule); err != nil {
+		logger.Errorw("error while trying to encode", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// ListSchedules handles GET requests to the /exports/schedules endpoint.
+func (e *Export) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+	page := middleware.GetPagination(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if page.SortBy != "created_at" {
+		BadRequestError(w, "schedules can only be sorted by 'created'")
+		return
+	}
+
+	schedules, count, err := e.DB.ListSchedules(mapUsertoModelUser(user), page.Offset, page.Limit, page.SortBy, page.Dir)
+	if err != nil {
+		logger.Errorw("error while retrieving schedules from database", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	apiSchedules := make([]ExportSchedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		apiSchedules = append(apiSchedules, DBScheduleToAPI(*schedule))
+	}
+
+	resp, err := middleware.GetPaginatedResponse(r.URL, page, count, apiSchedules)
+	if err != nil {
+		logger.Errorw("error while paginating data", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// GetSchedule handles GET requests to the /exports/schedules/{scheduleUUID} endpoint.
+func (e *Export) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	schedule := e.getScheduleWithUser(w, r, logger)
+	if schedule == nil {
+		return
+	}
+
+	apiSchedule := DBScheduleToAPI(*schedule)
+	if err := json.NewEncoder(w).Encode(&apiSchedule); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// PutSchedule handles PUT requests to the /exports/schedules/{scheduleUUID}
+// endpoint. The definition, cron expression and enabled flag of the schedule
+// are replaced, and its next run is calculated again. The schedule runs with
+// the identity of this request from then on.
+func (e *Export) PutSchedule(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	schedule := e.getScheduleWithUser(w, r, logger)
+	if schedule == nil {
+		return
+	}
+
+	if !e.decodeSchedule(w, r, logger, schedule) {
+		return
+	}
+	schedule.SetIdentity(r.Header.Get("X-Rh-Identity"), config.Get().ScheduleIdentityTTL)
+
+	if err := e.DB.UpdateSchedule(schedule); err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", schedule.ID))
+			return
+		default:
+			logger.Errorw("error updating schedule entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	apiSchedule := DBScheduleToAPI(*schedule)
+	if err := json.NewEncoder(w).Encode(&apiSchedule); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+// DeleteSchedule handles DELETE requests to the /exports/schedules/{scheduleUUID}
+// endpoint. Exports which were created by the schedule are not affected.
+func (e *Export) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	reqID := request_id.GetReqID(r.Context())
+	user := middleware.GetUserIdentity(r.Context())
+
+	uid := chi.URLParam(r, "scheduleUUID")
+	scheduleUUID, err := uuid.Parse(uid)
+	if err != nil {
+		BadRequestError(w, fmt.Sprintf("'%s' is not a valid schedule UUID", uid))
+		return
+	}
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	if err := e.DB.DeleteSchedule(scheduleUUID, mapUsertoModelUser(user)); err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", scheduleUUID))
+			return
+		default:
+			logger.Errorw("error deleting schedule entry", "error", err)
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSchedule decodes and validates the schedule in the body of the request
+// into schedule, and calculates its next run. An error response is written, and
+// false returned, if it is invalid.
+func (e *Export) decodeSchedule(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, schedule *models.ExportSchedule) bool {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Errorw("error while parsing params", "error", err)
+		BadRequestError(w, err.Error())
+		return false
+	}
+
+	if req.DefinitionID == uuid.Nil {
+		BadRequestError(w, "no definition_id provided")
+		return false
+	}
+
+	if req.Cron == "" {
+		BadRequestError(w, "no cron provided")
+		return false
+	}
+
+	if _, err := models.ParseCron(req.Cron); err != nil {
+		BadRequestError(w, fmt.Sprintf("invalid cron: %s", err))
+		return false
+	}
+
+	_, err := e.DB.GetDefinition(req.DefinitionID, schedule.User)
+	if err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			BadRequestError(w, fmt.Sprintf("definition '%s' not found", req.DefinitionID))
+			return false
+		default:
+			logger.Errorw("error querying for definition entry", "error", err)
+			InternalServerError(w, err)
+			return false
+		}
+	}
+
+	schedule.DefinitionID = req.DefinitionID
+	schedule.Cron = req.Cron
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	if err := schedule.Advance(time.Now()); err != nil {
+		BadRequestError(w, fmt.Sprintf("invalid cron: %s", err))
+		return false
+	}
+	return true
+}
+
+func (e *Export) getScheduleWithUser(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger) *models.ExportSchedule {
+	uid := chi.URLParam(r, "scheduleUUID")
+	scheduleUUID, err := uuid.Parse(uid)
+	if err != nil {
+		BadRequestError(w, fmt.Sprintf("'%s' is not a valid schedule UUID", uid))
+		return nil
+	}
+
+	user := middleware.GetUserIdentity(r.Context())
+
+	schedule, err := e.DB.GetSchedule(scheduleUUID, mapUsertoModelUser(user))
+	if err != nil {
+		switch err {
+		case models.ErrRecordNotFound:
+			logger.Infof("record '%s' not found", scheduleUUID)
+			NotFoundError(w, fmt.Sprintf("record '%s' not found", scheduleUUID))
+			return nil
+		default:
+			logger.Errorw("error querying for schedule entry", "error", err)
+			InternalServerError(w, err)
+			return nil
+		}
+	}
+
+	return schedule
+}
+
+func DBScheduleToAPI(schedule models.ExportSchedule) ExportSchedule {
+	apiSchedule := ExportSchedule{
+		ID:                schedule.ID.String(),
+		CreatedAt:         schedule.CreatedAt.UTC(),
+		UpdatedAt:         schedule.UpdatedAt.UTC(),
+		DefinitionID:      schedule.DefinitionID.String(),
+		Cron:              schedule.Cron,
+		Enabled:           schedule.Enabled,
+		LastExportID:      schedule.LastExportID,
+		IdentityExpiresAt: schedule.IdentityExpiresAt.UTC(),
+	}
+	if schedule.NextRunAt != nil {
+		next := schedule.NextRunAt.UTC()
+		apiSchedule.NextRunAt = &next
+	}
+	if schedule.LastRunAt != nil {
+		last := schedule.LastRunAt.UTC()
+		apiSchedule.LastRunAt = &last
+	}
+	return apiSchedule
+}
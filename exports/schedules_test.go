@@ -0,0 +1,334 @@
+package exports_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/exports"
+	"github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+func createTestSchedule(router chi.Router, body string) exports.ExportSchedule {
+	rr := exportsRequest(router, "POST", "/schedules", body)
+	Expect(rr.Code).To(Equal(http.StatusCreated))
+
+	var schedule exports.ExportSchedule
+	err := json.Unmarshal(rr.Body.Bytes(), &schedule)
+	Expect(err).ShouldNot(HaveOccurred())
+	return schedule
+}
+
+// makeScheduleDue moves the next run of a schedule into the past.
+func makeScheduleDue(scheduleID string) {
+	testGormDB.Exec("UPDATE export_schedules SET next_run_at = ? WHERE id = ?", time.Now().Add(-time.Minute), scheduleID)
+}
+
+var _ = Describe("Export schedules", func() {
+	It("can create and get a schedule", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "0 6 * * 1"}`, definition.ID))
+		Expect(schedule.ID).ToNot(BeEmpty())
+		Expect(schedule.DefinitionID).To(Equal(definition.ID))
+		Expect(schedule.Cron).To(Equal("0 6 * * 1"))
+		Expect(schedule.Enabled).To(BeTrue())
+		Expect(schedule.NextRunAt).ToNot(BeNil())
+		Expect(schedule.NextRunAt.Weekday()).To(Equal(time.Monday))
+		Expect(schedule.LastRunAt).To(BeNil())
+
+		rr := exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var fetched exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &fetched)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fetched.ID).To(Equal(schedule.ID))
+		Expect(*fetched.NextRunAt).To(BeTemporally("~", *schedule.NextRunAt, time.Second))
+	})
+
+	It("can list schedules", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+
+		createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+		createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@weekly"}`, definition.ID))
+
+		rr := exportsRequest(router, "GET", "/schedules?limit=1", "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var resp struct {
+			Meta struct {
+				Count int `json:"count"`
+			} `json:"meta"`
+			Data []exports.ExportSchedule `json:"data"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(resp.Meta.Count).To(Equal(2))
+		Expect(resp.Data).To(HaveLen(1))
+
+		rr = exportsRequest(router, "GET", "/schedules?sort=name", "")
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("can disable and delete a schedule", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+
+		rr := exportsRequest(router, "PUT", "/schedules/"+schedule.ID, fmt.Sprintf(`{"definition_id": "%s", "cron": "@hourly", "enabled": false}`, definition.ID))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var updated exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &updated)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(updated.Cron).To(Equal("@hourly"))
+		Expect(updated.Enabled).To(BeFalse())
+		Expect(updated.NextRunAt).To(BeNil())
+
+		rr = exportsRequest(router, "DELETE", "/schedules/"+schedule.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNoContent))
+
+		rr = exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("deletes the schedules of a deleted definition", func() {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+
+		rr := exportsRequest(router, "DELETE", "/definitions/"+definition.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNoContent))
+
+		rr = exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+	})
+
+	DescribeTable("validates schedules", func(body func(definitionID string) string, expectedBody string) {
+		router := setupTest(mockRequestApplicationResources)
+		definition := createTestDefinition(router)
+
+		rr := exportsRequest(router, "POST", "/schedules", body(definition.ID))
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		Expect(rr.Body.String()).To(ContainSubstring(expectedBody))
+	},
+		Entry("missing definition",
+			func(string) string { return `{"cron": "@daily"}` },
+			"no definition_id provided"),
+		Entry("unknown definition",
+			func(string) string { return fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, uuid.New()) },
+			"not found"),
+		Entry("missing cron",
+			func(id string) string { return fmt.Sprintf(`{"definition_id": "%s"}`, id) },
+			"no cron provided"),
+		Entry("invalid cron",
+			func(id string) string { return fmt.Sprintf(`{"definition_id": "%s", "cron": "every day"}`, id) },
+			"invalid cron"),
+		Entry("cron which never runs",
+			func(id string) string { return fmt.Sprintf(`{"definition_id": "%s", "cron": "0 0 30 2 *"}`, id) },
+			"never runs"),
+	)
+})
+
+var _ = Describe("Scheduler", func() {
+	var (
+		router     chi.Router
+		requested  []models.ExportPayload
+		identities []string
+		scheduler  *exports.Scheduler
+	)
+
+	BeforeEach(func() {
+		router = setupTest(mockRequestApplicationResources)
+		requested = nil
+		identities = nil
+		scheduler = &exports.Scheduler{
+			DB:  &models.ExportDB{DB: testGormDB, Cfg: config.Get()},
+			Log: logger.Get(),
+			RequestAppResources: func(ctx context.Context, log *zap.SugaredLogger, identity string, payload models.ExportPayload) {
+				requested = append(requested, payload)
+				identities = append(identities, identity)
+			},
+			PublishLifecycleEvent: mockPublishLifecycleEvent,
+			Interval:              time.Minute,
+		}
+	})
+
+	It("creates an export for a due schedule", func() {
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+
+		// nothing is due yet
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+
+		makeScheduleDue(schedule.ID)
+		Expect(scheduler.RunDue(context.Background())).To(Equal(1))
+
+		Expect(requested).To(HaveLen(1))
+		Expect(requested[0].Name).To(Equal("Weekly report"))
+		Expect(requested[0].Sources).To(HaveLen(2))
+		Expect(identities).To(ConsistOf(Not(BeEmpty())))
+		// the export has no retry policy, the identity is not kept
+		Expect(requested[0].Identity).To(BeEmpty())
+		Expect(publishedLifecycleEvents).To(ConsistOf(lifecycleEvent{Event: exports.ExportCreated, ExportID: requested[0].ID}))
+
+		rr := exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var ran exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &ran)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(ran.LastRunAt).ToNot(BeNil())
+		Expect(ran.LastExportID).To(HaveValue(Equal(requested[0].ID)))
+		Expect(ran.NextRunAt.After(time.Now())).To(BeTrue())
+
+		// the export belongs to the user who created the schedule
+		rr = httptest.NewRecorder()
+		req, err := http.NewRequest("GET", fmt.Sprintf("/api/export/v1/exports/%s/status", requested[0].ID), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		AddDebugUserIdentity(req)
+		router.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Body.String()).To(ContainSubstring(`"status":"pending"`))
+
+		// the schedule only runs once
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+	})
+
+	It("skips disabled schedules", func() {
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily", "enabled": false}`, definition.ID))
+
+		makeScheduleDue(schedule.ID)
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+		Expect(requested).To(BeEmpty())
+	})
+
+	It("disables schedules whose identity expired until they are updated", func() {
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+		Expect(schedule.IdentityExpiresAt.After(time.Now())).To(BeTrue())
+
+		testGormDB.Exec("UPDATE export_schedules SET identity_expires_at = ? WHERE id = ?", time.Now().Add(-time.Minute), schedule.ID)
+		makeScheduleDue(schedule.ID)
+
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+		Expect(requested).To(BeEmpty())
+
+		rr := exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		var disabled exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &disabled)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(disabled.Enabled).To(BeFalse())
+		Expect(disabled.NextRunAt).To(BeNil())
+
+		// updating the schedule renews its identity
+		rr = exportsRequest(router, "PUT", "/schedules/"+schedule.ID, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		var updated exports.ExportSchedule
+		err = json.Unmarshal(rr.Body.Bytes(), &updated)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(updated.Enabled).To(BeTrue())
+		Expect(updated.IdentityExpiresAt.After(time.Now())).To(BeTrue())
+
+		makeScheduleDue(schedule.ID)
+		Expect(scheduler.RunDue(context.Background())).To(Equal(1))
+	})
+
+	It("does not create an export for a definition which is no longer exportable", func() {
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+
+		testGormDB.Exec(`UPDATE export_definitions SET sources = '[{"application": "fakeApp", "resource": "exampleResource"}]' WHERE id = ?`, definition.ID)
+		makeScheduleDue(schedule.ID)
+
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+		Expect(requested).To(BeEmpty())
+
+		// the schedule still moves on to its next run
+		rr := exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		var skipped exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &skipped)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(skipped.Enabled).To(BeTrue())
+		Expect(skipped.NextRunAt.After(time.Now())).To(BeTrue())
+		Expect(skipped.LastExportID).To(BeNil())
+	})
+
+	It("does not create an export for an organization which exceeds its quota", func() {
+		cfg := config.Get()
+		defaults := cfg.Quota
+		cfg.Quota = config.Quota{MaxInFlight: 1}
+		DeferCleanup(func() { cfg.Quota = defaults })
+
+		createTestExport(router)
+		definition := createTestDefinition(router)
+		schedule := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+		makeScheduleDue(schedule.ID)
+
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+		Expect(requested).To(BeEmpty())
+
+		// the run is skipped rather than retried
+		rr := exportsRequest(router, "GET", "/schedules/"+schedule.ID, "")
+		var skipped exports.ExportSchedule
+		err := json.Unmarshal(rr.Body.Bytes(), &skipped)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(skipped.NextRunAt.After(time.Now())).To(BeTrue())
+		Expect(skipped.LastExportID).To(BeNil())
+	})
+
+	It("runs the other schedules when one of them fails", func() {
+		definition := createTestDefinition(router)
+		failing := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+		other := createTestSchedule(router, fmt.Sprintf(`{"definition_id": "%s", "cron": "@daily"}`, definition.ID))
+
+		// the failing schedule has been due the longest, so it is run first
+		testGormDB.Exec("UPDATE export_schedules SET next_run_at = ? WHERE id = ?", time.Now().Add(-time.Hour), failing.ID)
+		makeScheduleDue(other.ID)
+		scheduler.DB = failingScheduleDB{DBInterface: scheduler.DB, failing: failing.ID}
+
+		Expect(scheduler.RunDue(context.Background())).To(Equal(1))
+		Expect(requested).To(HaveLen(1))
+
+		var failed models.ExportSchedule
+		Expect(testGormDB.Take(&failed, "id = ?", failing.ID).Error).To(Succeed())
+		Expect(failed.Failures).To(Equal(1))
+		Expect(failed.LastError).To(Equal("boom"))
+		Expect(failed.LastExportID).To(BeNil())
+		Expect(failed.NextRunAt.After(time.Now())).To(BeTrue())
+
+		// the schedule is backed off rather than run again on every tick
+		Expect(scheduler.RunDue(context.Background())).To(Equal(0))
+	})
+})
+
+// failingScheduleDB fails every run of the schedule with the given id.
+type failingScheduleDB struct {
+	models.DBInterface
+	failing string
+}
+
+func (db failingScheduleDB) RunDueSchedule(now time.Time, fn func(tx *models.ExportDB, schedule *models.ExportSchedule) error) (bool, error) {
+	return db.DBInterface.RunDueSchedule(now, func(tx *models.ExportDB, schedule *models.ExportSchedule) error {
+		if schedule.ID.String() == db.failing {
+			return errors.New("boom")
+		}
+		return fn(tx, schedule)
+	})
+}
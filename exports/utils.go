@@ -1,11 +1,20 @@
 package exports
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/netip"
 	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"gorm.io/datatypes"
+
 	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/webhooks"
 )
 
 const (
@@ -53,3 +62,113 @@ func parseDate(str string) (result time.Time, err error) {
 
 	return
 }
+
+// parseFormat converts the format of a request into a payload format.
+func parseFormat(format string) (models.PayloadFormat, error) {
+	if !slices.Contains(models.PayloadFormats, models.PayloadFormat(format)) {
+		return "", fmt.Errorf("invalid or missing payload format")
+	}
+	return models.PayloadFormat(format), nil
+}
+
+// parseArchive converts the archive of a request into an archive format. Exports
+// are zipped unless another archive is requested.
+func parseArchive(archive string) (models.ArchiveFormat, error) {
+	if archive == "" {
+		return models.Zip, nil
+	}
+	if !slices.Contains(models.ArchiveFormats, models.ArchiveFormat(archive)) {
+		return "", fmt.Errorf("invalid archive '%s'", archive)
+	}
+	return models.ArchiveFormat(archive), nil
+}
+
+// verifyFilters verifies that the filters of a source, if any, are a json object.
+func verifyFilters(filters datatypes.JSON) error {
+	if filters == nil {
+		return nil
+	}
+	var dst map[string]interface{}
+	if err := json.Unmarshal(filters, &dst); err != nil {
+		return fmt.Errorf("invalid json format of filters")
+	}
+	return nil
+}
+
+// verifyCallbackURL verifies that the callback URL of an export is an absolute
+// https URL, that its host is allowed if the allowed hosts are limited, and
+// that it does not point to a private or otherwise non-public address.
+func verifyCallbackURL(raw string, allowedHosts []string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("callback_url must not contain credentials")
+	}
+	if len(allowedHosts) > 0 && !slices.Contains(allowedHosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("callback_url host '%s' is not allowed", u.Hostname())
+	}
+	// other host names are checked once they are resolved, when the
+	// notification is sent
+	addr, err := netip.ParseAddr(u.Hostname())
+	if (err == nil && !webhooks.PublicAddress(addr)) || strings.EqualFold(u.Hostname(), "localhost") {
+		return fmt.Errorf("callback_url must point to a public address")
+	}
+	return nil
+}
+
+// requestHash returns a hash of the contents of a new export. It does not
+// depend on the formatting of the request, nor on the order of the filters.
+func requestHash(payload *models.ExportPayload) string {
+	type hashedSource struct {
+		Application string                 `json:"application"`
+		Resource    string                 `json:"resource"`
+		Filters     map[string]interface{} `json:"filters"`
+	}
+	contents := struct {
+		Name           string         `json:"name"`
+		Format         string         `json:"format"`
+		Archive        string         `json:"archive,omitempty"`
+		Encryption     string         `json:"encryption,omitempty"`
+		PublicKey      string         `json:"public_key,omitempty"`
+		Expires        *time.Time     `json:"expires_at"`
+		Sources        []hashedSource `json:"sources"`
+		CallbackURL    string         `json:"callback_url"`
+		CallbackSecret string         `json:"callback_secret"`
+	}{
+		Name:           payload.Name,
+		Format:         string(payload.Format),
+		CallbackURL:    payload.CallbackURL,
+		CallbackSecret: payload.CallbackSecret,
+	}
+	if payload.Expires != nil {
+		expires := payload.Expires.UTC()
+		contents.Expires = &expires
+	}
+	if payload.Archive != models.Zip {
+		// zip is left out so that requests which predate the archive option
+		// keep their hash
+		contents.Archive = string(payload.Archive)
+	}
+	if payload.Encryption.Type != "" {
+		// passwords are left out, so that they can not be recovered from the
+		// hash
+		contents.Encryption = string(payload.Encryption.Type)
+		if payload.Encryption.Type != models.PasswordEncryption {
+			contents.PublicKey = payload.Encryption.Key
+		}
+	}
+	for _, source := range payload.Sources {
+		hashed := hashedSource{Application: source.Application, Resource: source.Resource}
+		if source.Filters != nil {
+			// the filters have already been verified to be a json object
+			_ = json.Unmarshal(source.Filters, &hashed.Filters)
+		}
+		contents.Sources = append(contents.Sources, hashed)
+	}
+
+	b, _ := json.Marshal(contents)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package exports
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/redhatinsights/platform-go-middlewares/v2/request_id"
+
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/middleware"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// GetWebhookDeliveries handles GET requests to the /exports/{exportUUID}/deliveries
+// endpoint. It lists every attempt to notify the callback URL of the export.
+func (e *Export) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserIdentity(r.Context())
+	reqID := request_id.GetReqID(r.Context())
+
+	logger := e.Log.With(export_logger.RequestIDField(reqID), export_logger.OrgIDField(user.OrganizationID))
+
+	export := e.getExportWithUser(w, r, logger)
+	if export == nil {
+		return
+	}
+
+	deliveries, err := e.DB.ListWebhookDeliveries(export.ID)
+	if err != nil {
+		logger.Errorw("error while retrieving webhook deliveries from database", "error", err)
+		InternalServerError(w, err)
+		return
+	}
+
+	apiDeliveries := make([]WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		apiDeliveries = append(apiDeliveries, DBWebhookDeliveryToAPI(*delivery))
+	}
+
+	if err := json.NewEncoder(w).Encode(&apiDeliveries); err != nil {
+		logger.Errorw("error while encoding", "error", err)
+		InternalServerError(w, err.Error())
+	}
+}
+
+func DBWebhookDeliveryToAPI(delivery models.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		ID:         delivery.ID.String(),
+		CreatedAt:  delivery.CreatedAt.UTC(),
+		DeliveryID: delivery.DeliveryID.String(),
+		URL:        delivery.URL,
+		Status:     string(delivery.Status),
+		Attempt:    delivery.Attempt,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error,
+		Delivered:  delivery.Delivered,
+	}
+}
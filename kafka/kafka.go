@@ -1,7 +1,9 @@
 package kafka
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
@@ -40,45 +42,90 @@ func init() {
 	prometheus.MustRegister(producerCount)
 }
 
-type Producer struct{ *kafka.Producer }
+// produceAttempts is how often a message is produced before it is dropped,
+// waiting produceBackoff after the first failed attempt, and twice as long
+// after every further one.
+const (
+	produceAttempts = 3
+	produceBackoff  = time.Second
+)
+
+type Producer struct {
+	*kafka.Producer
 
-// StartProducer produces kafka messages on the kafka topic
+	// inFlight tracks the messages which are still being produced
+	inFlight sync.WaitGroup
+}
+
+// StartProducer produces kafka messages on the kafka topic. It returns once
+// msgChan is closed and every message received has been delivered or dropped,
+// so that the producer can be flushed and closed afterwards.
 func (p *Producer) StartProducer(msgChan chan *kafka.Message) {
 	log.Infof("started kafka producer: %+v", p)
-	topic := cfg.KafkaConfig.ExportsTopic
 	for msg := range msgChan {
+		p.inFlight.Add(1)
 		go func(msg *kafka.Message) {
-			deliveryChan := make(chan kafka.Event)
-			defer close(deliveryChan)
+			defer p.inFlight.Done()
 
 			producerCount.Inc()
 			defer producerCount.Dec()
 
-			start := time.Now()
-			err := p.Produce(msg, deliveryChan)
-			if err != nil {
-				log.Errorw("failed to produce message", "error", err)
-				return
+			// failed messages are produced again here rather than sent back
+			// to msgChan, which may already be closed
+			if err := p.Deliver(msg); err != nil {
+				log.Errorw("dropped kafka message", "topic", *msg.TopicPartition.Topic, "attempts", produceAttempts, "error", err)
 			}
+		}(msg)
+	}
+	p.inFlight.Wait()
+}
+
+// Deliver produces msg until it has been delivered, up to produceAttempts
+// times, and returns the error of the last attempt if it never was.
+func (p *Producer) Deliver(msg *kafka.Message) error {
+	topic := *msg.TopicPartition.Topic
+	backoff := produceBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.produce(msg)
+		if err == nil {
+			return nil
+		}
+		publishFailures.With(prometheus.Labels{"topic": topic}).Inc()
+		if attempt == produceAttempts {
+			return err
+		}
+		log.Warnw("failed to publish kafka message, retrying", "topic", topic, "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
 
-			messagePublishElapsed.With(prometheus.Labels{"topic": topic}).Observe(time.Since(start).Seconds())
+// produce produces a single message and waits for its delivery report. It
+// returns nil once the message has been delivered.
+func (p *Producer) produce(msg *kafka.Message) error {
+	topic := *msg.TopicPartition.Topic
 
-			e := <-deliveryChan
-			m, ok := e.(*kafka.Message)
-			if !ok {
-				log.Errorw("error publishing to kafka", "error", "invalid message type")
-				return
-			}
+	deliveryChan := make(chan kafka.Event)
+	defer close(deliveryChan)
 
-			if m.TopicPartition.Error != nil {
-				log.Errorw("error publishing to kafka", "error", m.TopicPartition.Error)
-				msgChan <- msg
-				publishFailures.With(prometheus.Labels{"topic": topic}).Inc()
-			} else {
-				messagesPublished.With(prometheus.Labels{"topic": topic}).Inc()
-			}
-		}(msg)
+	start := time.Now()
+	if err := p.Produce(msg, deliveryChan); err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
 	}
+
+	messagePublishElapsed.With(prometheus.Labels{"topic": topic}).Observe(time.Since(start).Seconds())
+
+	e := <-deliveryChan
+	m, ok := e.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery report: %v", e)
+	}
+	if m.TopicPartition.Error != nil {
+		return m.TopicPartition.Error
+	}
+
+	messagesPublished.With(prometheus.Labels{"topic": topic}).Inc()
+	return nil
 }
 
 // NewProducer generates a new kafka producer
@@ -88,6 +135,7 @@ func NewProducer() (*Producer, error) {
 		"client.id", cfg.Hostname,
 		"bootstrap.servers", brokers,
 		"topic", cfg.KafkaConfig.ExportsTopic,
+		"lifecycle_topic", cfg.KafkaConfig.LifecycleTopic,
 		"loglevel", cfg.LogLevel,
 		"debug", cfg.Debug,
 	)
@@ -111,5 +159,5 @@ func NewProducer() (*Producer, error) {
 	}
 
 	p, err := kafka.NewProducer(kcfg)
-	return &Producer{p}, err
+	return &Producer{Producer: p}, err
 }
@@ -29,16 +29,52 @@ func (kh KafkaHeader) ToHeader() []kafka.Header {
 }
 
 type KafkaMessage struct {
-	ID          uuid.UUID                        `json:"id"`
-	Schema      string                           `json:"$schema"`
-	Source      string                           `json:"source"`
-	Subject     string                           `json:"subject"`
-	SpecVersion string                           `json:"specversion"`
-	Type        string                           `json:"type"`
-	Time        string                           `json:"time"`
-	OrgID       string                           `json:"redhatorgid"`
-	DataSchema  string                           `json:"dataschema"`
-	Data        cloudEventSchema.ResourceRequest `json:"data"`
+	ID          uuid.UUID   `json:"id"`
+	Schema      string      `json:"$schema"`
+	Source      string      `json:"source"`
+	Subject     string      `json:"subject"`
+	SpecVersion string      `json:"specversion"`
+	Type        string      `json:"type"`
+	Time        string      `json:"time"`
+	OrgID       string      `json:"redhatorgid"`
+	DataSchema  string      `json:"dataschema"`
+	Data        interface{} `json:"data"`
+}
+
+// ResourceCancellation is the event data sent to a source application when an
+// export that it was asked to provide a resource for has been cancelled.
+type ResourceCancellation struct {
+	ResourceCancellation ResourceCancellationClass `json:"resource_cancellation"`
+}
+
+// ResourceCancellationClass identifies the resource request that was cancelled.
+type ResourceCancellationClass struct {
+	Application       string `json:"application"`
+	ExportRequestUUID string `json:"export_request_uuid"`
+	Resource          string `json:"resource"`
+	UUID              string `json:"uuid"`
+	XRhIdentity       string `json:"x-rh-identity"`
+}
+
+// ExportLifecycle is the event data published when an export is created,
+// finished, about to expire or deleted.
+type ExportLifecycle struct {
+	ExportLifecycle ExportLifecycleClass `json:"export_lifecycle"`
+}
+
+// ExportLifecycleClass describes the export that the event is about.
+type ExportLifecycleClass struct {
+	Event             string   `json:"event"`
+	ExportRequestUUID string   `json:"export_request_uuid"`
+	Name              string   `json:"name"`
+	Format            string   `json:"format"`
+	Status            string   `json:"status"`
+	Applications      []string `json:"applications,omitempty"`
+	CreatedAt         string   `json:"created_at"`
+	CompletedAt       string   `json:"completed_at,omitempty"`
+	ExpiresAt         string   `json:"expires_at,omitempty"`
+	AccountID         string   `json:"account_id,omitempty"`
+	Username          string   `json:"username"`
 }
 
 func ParseFormat(s string) (result cloudEventSchema.Format, ok bool) {
@@ -47,6 +83,10 @@ func ParseFormat(s string) (result cloudEventSchema.Format, ok bool) {
 		return cloudEventSchema.CSV, true
 	case "json":
 		return cloudEventSchema.JSON, true
+	case "ndjson", "xlsx", "parquet":
+		// not part of the schema, these are only requested from the
+		// applications which produce them natively
+		return cloudEventSchema.Format(s), true
 	default:
 		return "", false
 	}
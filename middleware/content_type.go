@@ -18,11 +18,6 @@ func SetContentType(ct string) func(next http.Handler) http.Handler {
 	return fn1
 }
 
-// GZIPContentType is a middleware that sets the Content-Type to `application/gzip`.
-func GZIPContentType(next http.Handler) http.Handler {
-	return SetContentType("application/gzip")(next)
-}
-
 // JSONContentType is a middleware that sets the Content-Type to `application/json`.
 func JSONContentType(next http.Handler) http.Handler {
 	return SetContentType("application/json")(next)
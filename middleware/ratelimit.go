@@ -0,0 +1,132 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// minLimiterIdle is how long the limiter of a user is kept without requests.
+// Limiters which take longer to refill are kept until they are full again.
+const minLimiterIdle = 10 * time.Minute
+
+// RateLimiter limits the requests of every user of every organization
+// separately, so that a busy tenant does not slow down the others. Requests
+// over the limit are rejected with a 429 and a Retry-After header instead of
+// waiting.
+type RateLimiter struct {
+	// Name describes the requests that are limited, e.g. in error messages.
+	Name  string
+	limit rate.Limit
+	burst int
+	idle  time.Duration
+
+	mu        sync.Mutex
+	limiters  map[string]*userLimiter
+	lastSweep time.Time
+}
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimits are the rate limiters of the classes of requests to the API.
+type RateLimits struct {
+	// Create limits the requests which create exports.
+	Create *RateLimiter
+	// List limits listing exports, and every request that is not limited
+	// by another class.
+	List *RateLimiter
+	// Download limits the downloads of exports and their sources.
+	Download *RateLimiter
+}
+
+// NewRateLimiter returns a RateLimiter which allows every user limit requests
+// per second, with bursts of up to burst requests.
+func NewRateLimiter(name string, limit rate.Limit, burst int) *RateLimiter {
+	idle := minLimiterIdle
+	if limit > 0 {
+		if refill := time.Duration(float64(burst) / float64(limit) * float64(time.Second)); refill > idle {
+			idle = refill
+		}
+	}
+	return &RateLimiter{
+		Name:     name,
+		limit:    limit,
+		burst:    burst,
+		idle:     idle,
+		limiters: make(map[string]*userLimiter),
+	}
+}
+
+// Limit is a middleware that rejects the request if its user exceeded the rate
+// limit. It has to run after EnforceUserIdentity. A nil RateLimiter does not
+// limit any requests.
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+	if rl == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUserIdentity(r.Context())
+
+		if delay := rl.reserve(user.OrganizationID + "/" + user.Username); delay > 0 {
+			seconds := int(math.Ceil(delay.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			JSONError(w, fmt.Sprintf("too many %s requests, retry in %d seconds", rl.Name, seconds), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reserve takes a token from the limiter of key, and returns how long the
+// request has to wait if there is none. No token is taken in that case.
+func (rl *RateLimiter) reserve(key string) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	ul, ok := rl.limiters[key]
+	if !ok {
+		ul = &userLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.limiters[key] = ul
+	}
+	ul.lastSeen = now
+
+	reservation := ul.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		// the burst is 0, nothing is ever allowed
+		return rl.idle
+	}
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// sweep forgets the limiters which have been idle for long enough to be full
+// again, so that they do not accumulate.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idle {
+		return
+	}
+	rl.lastSweep = now
+	for key, ul := range rl.limiters {
+		if now.Sub(ul.lastSeen) >= rl.idle {
+			delete(rl.limiters, key)
+		}
+	}
+}
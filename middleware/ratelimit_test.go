@@ -0,0 +1,66 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"golang.org/x/time/rate"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/middleware"
+)
+
+var _ = Describe("RateLimiter", func() {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(handler http.Handler, orgID, username string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		user := middleware.User{AccountID: "540155", OrganizationID: orgID, Username: username}
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIdentityKey, user))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	It("rejects requests over the limit with a 429 and Retry-After", func() {
+		handler := middleware.NewRateLimiter("create", rate.Limit(0.1), 2).Limit(okHandler)
+
+		Expect(request(handler, "1979710", "username").Code).To(Equal(http.StatusOK))
+		Expect(request(handler, "1979710", "username").Code).To(Equal(http.StatusOK))
+
+		rr := request(handler, "1979710", "username")
+		Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rr.Body.String()).To(ContainSubstring("too many create requests"))
+
+		retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(retryAfter).To(BeNumerically(">", 0))
+		Expect(retryAfter).To(BeNumerically("<=", 10))
+	})
+
+	It("limits every user of every organization separately", func() {
+		handler := middleware.NewRateLimiter("list", rate.Limit(0.1), 1).Limit(okHandler)
+
+		Expect(request(handler, "1979710", "username").Code).To(Equal(http.StatusOK))
+		Expect(request(handler, "1979710", "username").Code).To(Equal(http.StatusTooManyRequests))
+
+		Expect(request(handler, "1979710", "other-username").Code).To(Equal(http.StatusOK))
+		Expect(request(handler, "2000000", "username").Code).To(Equal(http.StatusOK))
+	})
+
+	It("does not limit requests when it is nil", func() {
+		var limiter *middleware.RateLimiter
+		handler := limiter.Limit(okHandler)
+
+		for i := 0; i < 10; i++ {
+			Expect(request(handler, "1979710", "username").Code).To(Equal(http.StatusOK))
+		}
+	})
+})
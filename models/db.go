@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redhatinsights/export-service-go/config"
@@ -32,23 +33,314 @@ type ExportDB struct {
 type DBInterface interface {
 	APIList(user User, params *QueryParams, offset, limit int, sort, dir string) (result []*APIExport, count int64, err error)
 
+	Cancel(payload *ExportPayload) error
+	ClaimDueRetries(now time.Time, lease time.Duration) (result []ExportPayload, err error)
 	Create(payload *ExportPayload) (result *ExportPayload, err error)
+	CreateAllowed(payload *ExportPayload, window time.Duration, allow func(tx *ExportDB) error) (result *ExportPayload, created bool, err error)
+	CreateDefinition(definition *ExportDefinition) (result *ExportDefinition, err error)
+	DeleteDefinition(definitionUUID uuid.UUID, user User) error
+	GetDefinition(definitionUUID uuid.UUID, user User) (result *ExportDefinition, err error)
+	ListDefinitions(user User, offset, limit int, sort, dir string) (result []*ExportDefinition, count int64, err error)
+	UpdateDefinition(definition *ExportDefinition) error
+	CreateSchedule(schedule *ExportSchedule) (result *ExportSchedule, err error)
+	DeleteSchedule(scheduleUUID uuid.UUID, user User) error
+	GetSchedule(scheduleUUID uuid.UUID, user User) (result *ExportSchedule, err error)
+	ListSchedules(user User, offset, limit int, sort, dir string) (result []*ExportSchedule, count int64, err error)
+	UpdateSchedule(schedule *ExportSchedule) error
+	RunDueSchedule(now time.Time, fn func(tx *ExportDB, schedule *ExportSchedule) error) (found bool, err error)
+	CreateWebhookDelivery(delivery *WebhookDelivery) error
+	ListWebhookDeliveries(exportUUID uuid.UUID) (result []*WebhookDelivery, err error)
 	Delete(exportUUID uuid.UUID, user User) error
+	Finish(payload *ExportPayload, values ExportPayload) error
 	Get(exportUUID uuid.UUID) (result *ExportPayload, err error)
 	GetWithUser(exportUUID uuid.UUID, user User) (result *ExportPayload, err error)
 	List(user User) (result []*ExportPayload, err error)
 	Raw(sql string, values ...interface{}) *gorm.DB
+	Retry(payload *ExportPayload, sourceIDs []uuid.UUID, status PayloadStatus, identity string) error
+	Start(payload *ExportPayload) error
 	Updates(m *ExportPayload, values interface{}) error
-	DeleteExpiredExports() error
+	DeleteExpiredExports() (deleted []ExportPayload, err error)
+	ExpiringExports(within time.Duration) (result []ExportPayload, err error)
+	MarkExpiryNotified(payload ExportPayload) error
+	GetOrgUsage(orgID string, since time.Time) (result *OrgUsage, err error)
 }
 
 var ErrRecordNotFound = errors.New("record not found")
+var ErrNotCancellable = errors.New("export can no longer be cancelled")
+var ErrNotRetryable = errors.New("export can no longer be retried")
+var ErrAlreadyFinished = errors.New("export has already finished")
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// Cancel moves a pending or running export, and those of its sources that are
+// still pending, to the cancelled status in a single transaction. The status is
+// checked as part of the update so that an export which finishes concurrently
+// is never cancelled. The identity and archive keys of the export are
+// forgotten.
+func (edb *ExportDB) Cancel(payload *ExportPayload) error {
+	return edb.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&ExportPayload{}).
+			Where("id = ? AND status IN ?", payload.ID, []PayloadStatus{Pending, Running}).
+			Updates(ExportPayload{Status: Cancelled, CompletedAt: &now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotCancellable
+		}
+
+		err := tx.Model(&Source{}).
+			Where("export_payload_id = ? AND status = ?", payload.ID, RPending).
+			Update("status", RCancelled).
+			Error
+		if err != nil {
+			return err
+		}
+		if err := forgetSecrets(tx, payload); err != nil {
+			return err
+		}
+
+		payload.Status = Cancelled
+		payload.CompletedAt = &now
+		for i := range payload.Sources {
+			if payload.Sources[i].Status == RPending {
+				payload.Sources[i].Status = RCancelled
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimDueRetries returns the exports with pending sources whose retry is due,
+// each with only those sources, and moves their next attempt to the end of the
+// lease. Each source is only returned once per lease, even by concurrent
+// callers. A source whose request is lost, so that its application never
+// answers, is returned again once the lease has passed; the answer of the
+// application clears or reschedules the next attempt.
+func (edb *ExportDB) ClaimDueRetries(now time.Time, lease time.Duration) ([]ExportPayload, error) {
+	var sources []Source
+	err := edb.DB.Model(&sources).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND next_attempt_at <= ?", RPending, now).
+		Update("next_attempt_at", now.Add(lease)).
+		Error
+	if err != nil || len(sources) == 0 {
+		return nil, err
+	}
+
+	exportIDs := make([]uuid.UUID, 0, len(sources))
+	for _, source := range sources {
+		exportIDs = append(exportIDs, source.ExportPayloadID)
+	}
+
+	var exports []ExportPayload
+	err = edb.DB.Where("id IN ? AND status IN ?", exportIDs, []PayloadStatus{Pending, Running}).Find(&exports).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range exports {
+		for _, source := range sources {
+			if source.ExportPayloadID == exports[i].ID {
+				exports[i].Sources = append(exports[i].Sources, source)
+			}
+		}
+	}
+	return exports, nil
+}
+
+// Finish moves a pending or running export to the final status of values,
+// along with the other values. As with Cancel, the status is checked as part
+// of the update, so that an export which was cancelled concurrently is never
+// completed. ErrAlreadyFinished is returned if the export has already
+// reached a final status. The identity and archive keys of the export are
+// forgotten.
+func (edb *ExportDB) Finish(payload *ExportPayload, values ExportPayload) error {
+	return edb.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ExportPayload{}).
+			Where("id = ? AND status IN ?", payload.ID, []PayloadStatus{Pending, Running}).
+			Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyFinished
+		}
+		if err := forgetSecrets(tx, payload); err != nil {
+			return err
+		}
+
+		payload.Status = values.Status
+		payload.CompletedAt = values.CompletedAt
+		if values.S3Key != "" {
+			payload.S3Key = values.S3Key
+		}
+		return nil
+	})
+}
+
+// Start moves a pending export to running. As with Finish, the status is
+// checked as part of the update, so that an export which was cancelled or
+// finished concurrently is never running again. ErrAlreadyFinished is
+// returned if the export has already reached a final status.
+func (edb *ExportDB) Start(payload *ExportPayload) error {
+	result := edb.DB.Model(&ExportPayload{}).
+		Where("id = ? AND status IN ?", payload.ID, []PayloadStatus{Pending, Running}).
+		Update("status", Running)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyFinished
+	}
+	payload.Status = Running
+	return nil
+}
+
+// forgetSecrets clears the identity of an export, and the wrapped keys of an
+// export which is encrypted with a password. Both are only kept until the export
+// reaches a final status.
+func forgetSecrets(tx *gorm.DB, payload *ExportPayload) error {
+	err := tx.Model(&ExportPayload{}).
+		Where("id = ?", payload.ID).
+		Update("identity", "").
+		Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&ExportPayload{}).
+		Where("id = ? AND encryption_type = ?", payload.ID, PasswordEncryption).
+		Update("encryption_key", "").
+		Error
+	if err != nil {
+		return err
+	}
+	payload.Identity = ""
+	if payload.Encryption.Type == PasswordEncryption {
+		payload.Encryption.Key = ""
+	}
+	return nil
+}
+
+// Retry moves the given failed sources of a partial or failed export back to
+// pending, clearing their errors, and moves the export itself to status. As with
+// Cancel, the status of the export is checked as part of the update. The
+// archive of the export is forgotten, and has to be deleted by the caller. The
+// identity is kept until the export finishes again.
+func (edb *ExportDB) Retry(payload *ExportPayload, sourceIDs []uuid.UUID, status PayloadStatus, identity string) error {
+	return edb.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&ExportPayload{}).
+			Where("id = ? AND status IN ?", payload.ID, []PayloadStatus{Partial, Failed}).
+			Updates(map[string]interface{}{"status": status, "completed_at": nil, "s3_key": "", "archive_size": 0, "identity": identity})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotRetryable
+		}
+
+		err := tx.Model(&Source{}).
+			Where("export_payload_id = ? AND id IN ? AND status = ?", payload.ID, sourceIDs, RFailed).
+			Updates(map[string]interface{}{"status": RPending, "code": nil, "message": nil, "attempts": 1}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		payload.Status = status
+		payload.CompletedAt = nil
+		payload.S3Key = ""
+		payload.ArchiveSize = 0
+		payload.Identity = identity
+		for i := range payload.Sources {
+			for _, id := range sourceIDs {
+				if payload.Sources[i].ID == id && payload.Sources[i].Status == RFailed {
+					payload.Sources[i].Status = RPending
+					payload.Sources[i].SourceError = nil
+					payload.Sources[i].Attempts = 1
+				}
+			}
+		}
+		return nil
+	})
+}
 
 func (edb *ExportDB) Create(payload *ExportPayload) (*ExportPayload, error) {
 	result := edb.DB.Create(&payload)
 	return payload, result.Error
 }
 
+// CreateAllowed creates payload if allow, which is called with an ExportDB
+// bound to the same transaction, returns no error. Otherwise that error is
+// returned. Exports of the same organization are created one at a time, so
+// that allow sees every export created before it.
+//
+// If payload has an IdempotencyKey and its user already created an export with
+// the same key within window, that export is returned instead, created is false
+// and allow is not called. ErrIdempotencyKeyReused is returned if the earlier
+// export has a different RequestHash. Keys of exports older than window are
+// released, so that they can be used again.
+func (edb *ExportDB) CreateAllowed(payload *ExportPayload, window time.Duration, allow func(tx *ExportDB) error) (result *ExportPayload, created bool, err error) {
+	err = edb.DB.Transaction(func(tx *gorm.DB) error {
+		if payload.IdempotencyKey != "" {
+			existing, err := findIdempotent(tx, payload, window)
+			if err != nil || existing != nil {
+				result = existing
+				return err
+			}
+		}
+
+		// concurrent exports of the organization wait for each other here,
+		// after the idempotency key so that locks are always taken in order
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "org/"+payload.OrganizationID).Error; err != nil {
+			return err
+		}
+
+		if err := allow(&ExportDB{DB: tx, Cfg: edb.Cfg}); err != nil {
+			return err
+		}
+		if err := tx.Create(payload).Error; err != nil {
+			return err
+		}
+		result, created = payload, true
+		return nil
+	})
+	return
+}
+
+// findIdempotent returns the export which the user of payload created with the
+// same IdempotencyKey within window, or nil if there is none. Concurrent
+// requests with the same key wait for each other until tx ends.
+func findIdempotent(tx *gorm.DB, payload *ExportPayload, window time.Duration) (*ExportPayload, error) {
+	lockKey := strings.Join([]string{payload.AccountID, payload.OrganizationID, payload.Username, payload.IdempotencyKey}, "/")
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", lockKey).Error; err != nil {
+		return nil, err
+	}
+
+	byKey := &ExportPayload{User: payload.User, IdempotencyKey: payload.IdempotencyKey}
+	err := tx.Model(&ExportPayload{}).
+		Where(byKey).
+		Where("created_at < ?", time.Now().Add(-window)).
+		Update("idempotency_key", "").
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var existing ExportPayload
+	err = tx.Where(byKey).Preload("Sources").Take(&existing).Error
+	switch {
+	case err == nil:
+		if existing.RequestHash != payload.RequestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return &existing, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
 func (edb *ExportDB) Delete(exportUUID uuid.UUID, user User) error {
 	result := edb.DB.Where(&ExportPayload{ID: exportUUID, User: user}).Delete(&ExportPayload{})
 	if result.RowsAffected == 0 {
@@ -140,17 +432,33 @@ func (edb *ExportDB) Raw(sql string, values ...interface{}) *gorm.DB {
 	return edb.DB.Raw(sql, values...)
 }
 
-func (edb *ExportDB) DeleteExpiredExports() error {
+// lifecycleColumns are the columns returned by the statements which select
+// exports for a lifecycle event.
+var lifecycleColumns = []clause.Column{
+	{Name: "id"}, {Name: "created_at"}, {Name: "completed_at"}, {Name: "expires"}, {Name: "name"}, {Name: "format"}, {Name: "status"},
+	{Name: "account_id"}, {Name: "organization_id"}, {Name: "username"},
+}
+
+func lifecycleColumnNames() []string {
+	names := make([]string, 0, len(lifecycleColumns))
+	for _, column := range lifecycleColumns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// DeleteExpiredExports deletes the exports which expired more than
+// ExportExpiryDays ago, and returns them.
+func (edb *ExportDB) DeleteExpiredExports() ([]ExportPayload, error) {
 	log := logger.Get()
 
-	columnsToReturn := []clause.Column{{Name: "id"}, {Name: "account_id"}, {Name: "organization_id"}, {Name: "username"}}
 	expiredExportsClause := fmt.Sprintf("now() > expires + interval '%d days'", edb.Cfg.ExportExpiryDays)
 
 	var deletedExports []ExportPayload
-	err := edb.DB.Clauses(clause.Returning{Columns: columnsToReturn}).Where(expiredExportsClause).Delete(&deletedExports).Error
+	err := edb.DB.Clauses(clause.Returning{Columns: lifecycleColumns}).Where(expiredExportsClause).Delete(&deletedExports).Error
 	if err != nil {
 		log.Error("Unable to remove expired exports from the database", "error", err)
-		return err
+		return nil, err
 	}
 
 	for _, export := range deletedExports {
@@ -161,5 +469,51 @@ func (edb *ExportDB) DeleteExpiredExports() error {
 			"username", export.Username)
 	}
 
-	return nil
+	return deletedExports, nil
+}
+
+// ExpiringExports returns the finished exports which expire within the given
+// duration and have not been announced as expiring yet, see MarkExpiryNotified.
+func (edb *ExportDB) ExpiringExports(within time.Duration) ([]ExportPayload, error) {
+	var exports []ExportPayload
+	now := time.Now()
+	err := edb.DB.Select(lifecycleColumnNames()).
+		Where("status IN ? AND expiry_notified_at IS NULL AND expires > ? AND expires <= ?", []PayloadStatus{Complete, Partial}, now, now.Add(within)).
+		Find(&exports).
+		Error
+	return exports, err
+}
+
+// MarkExpiryNotified records that the export was announced as expiring, so
+// that it is no longer returned by ExpiringExports. Nothing is recorded if the
+// expiry of the export changed since it was returned, it is announced again.
+func (edb *ExportDB) MarkExpiryNotified(payload ExportPayload) error {
+	return edb.DB.Model(&ExportPayload{}).
+		Where("id = ? AND expires = ? AND expiry_notified_at IS NULL", payload.ID, payload.Expires).
+		Update("expiry_notified_at", time.Now()).
+		Error
+}
+
+// OrgUsage is what the exports of an organization count against its quota.
+type OrgUsage struct {
+	// InFlight is the number of exports which are pending or running
+	InFlight int64
+	// Created is the number of exports created since a given time
+	Created int64
+	// StoredBytes is the total size of the archives which are still stored
+	StoredBytes int64
+}
+
+// GetOrgUsage returns the usage of the organization, counting the exports
+// created since the given time.
+func (edb *ExportDB) GetOrgUsage(orgID string, since time.Time) (*OrgUsage, error) {
+	var usage OrgUsage
+	err := edb.DB.Model(&ExportPayload{}).
+		Select("count(*) FILTER (WHERE status IN ?) AS in_flight, "+
+			"count(*) FILTER (WHERE created_at >= ?) AS created, "+
+			"coalesce(sum(archive_size), 0) AS stored_bytes", []PayloadStatus{Pending, Running}, since).
+		Where("organization_id = ?", orgID).
+		Scan(&usage).
+		Error
+	return &usage, err
 }
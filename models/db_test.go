@@ -161,8 +161,11 @@ var _ = Describe("Db", func() {
 				Expect(result).To(Equal(exportPayload))
 				Expect(err).To(BeNil())
 
-				exportDeleteErr := exportDB.DeleteExpiredExports()
+				deleted, exportDeleteErr := exportDB.DeleteExpiredExports()
 				Expect(exportDeleteErr).To(BeNil())
+				Expect(deleted).To(HaveLen(1))
+				Expect(deleted[0].ID).To(Equal(exportPayload.ID))
+				Expect(deleted[0].Username).To(Equal("batman"))
 
 				_, getErr := exportDB.Get(exportPayload.ID)
 				Expect(getErr).To(HaveOccurred())
@@ -170,4 +173,96 @@ var _ = Describe("Db", func() {
 			})
 		})
 	})
+
+	Describe("ExpiringExports", func() {
+		It("returns each finished export which expires soon until it is marked as notified", func() {
+			setupTest(testGormDB)
+
+			user := m.User{AccountID: "1234", OrganizationID: "5678", Username: "batman"}
+			inAnHour := time.Now().Add(time.Hour)
+			nextWeek := time.Now().AddDate(0, 0, 7)
+
+			create := func(status m.PayloadStatus, expires *time.Time) *m.ExportPayload {
+				payload, err := exportDB.Create(&m.ExportPayload{Name: string(status), Status: status, Expires: expires, User: user})
+				Expect(err).To(BeNil())
+				return payload
+			}
+			expiring := create(m.Complete, &inAnHour)
+			create(m.Running, &inAnHour)
+			create(m.Complete, &nextWeek)
+
+			result, err := exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result[0].ID).To(Equal(expiring.ID))
+			Expect(result[0].Name).To(Equal("complete"))
+
+			// the export is returned again until its event was published
+			result, err = exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+
+			Expect(exportDB.MarkExpiryNotified(result[0])).To(Succeed())
+			result, err = exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(BeEmpty())
+
+			// moving the expiry announces it again
+			Expect(expiring.UpdateMetadata(exportDB, "", &inAnHour)).To(Succeed())
+			result, err = exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+		})
+
+		It("does not mark an export whose expiry moved after it was returned", func() {
+			setupTest(testGormDB)
+
+			inAnHour := time.Now().Add(time.Hour)
+			inTwoHours := time.Now().Add(2 * time.Hour)
+			expiring, err := exportDB.Create(&m.ExportPayload{Name: "complete", Status: m.Complete, Expires: &inAnHour})
+			Expect(err).To(BeNil())
+
+			result, err := exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+
+			Expect(expiring.UpdateMetadata(exportDB, "", &inTwoHours)).To(Succeed())
+			Expect(exportDB.MarkExpiryNotified(result[0])).To(Succeed())
+
+			result, err = exportDB.ExpiringExports(24 * time.Hour)
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(*result[0].Expires).To(BeTemporally("~", inTwoHours, time.Millisecond))
+		})
+	})
+
+	Describe("GetOrgUsage", func() {
+		It("counts the exports of the organization against its quota", func() {
+			setupTest(testGormDB)
+
+			user := m.User{AccountID: "1234", OrganizationID: "5678", Username: "batman"}
+			other := m.User{AccountID: "4321", OrganizationID: "8765", Username: "robin"}
+
+			create := func(user m.User, status m.PayloadStatus, size int64) *m.ExportPayload {
+				payload, err := exportDB.Create(&m.ExportPayload{Name: string(status), Status: status, User: user})
+				Expect(err).To(BeNil())
+				Expect(payload.SetArchiveSize(exportDB, size)).To(Succeed())
+				return payload
+			}
+			create(user, m.Pending, 0)
+			create(user, m.Running, 0)
+			create(user, m.Complete, 100)
+			old := create(user, m.Partial, 50)
+			create(other, m.Running, 1000)
+			testGormDB.Exec("UPDATE export_payloads SET created_at = ? WHERE id = ?", time.Now().Add(-48*time.Hour), old.ID)
+
+			usage, err := exportDB.GetOrgUsage("5678", time.Now().Add(-24*time.Hour))
+			Expect(err).To(BeNil())
+			Expect(*usage).To(Equal(m.OrgUsage{InFlight: 2, Created: 3, StoredBytes: 150}))
+
+			usage, err = exportDB.GetOrgUsage("0000", time.Now().Add(-24*time.Hour))
+			Expect(err).To(BeNil())
+			Expect(*usage).To(Equal(m.OrgUsage{}))
+		})
+	})
 })
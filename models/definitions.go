@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// DefinitionSource is a resource requested by every export created from an
+// ExportDefinition.
+type DefinitionSource struct {
+	Application string         `json:"application"`
+	Resource    string         `json:"resource"`
+	Filters     datatypes.JSON `json:"filters,omitempty"`
+}
+
+// ExportDefinition is a saved export request, which can be run any number of
+// times to create a new ExportPayload.
+type ExportDefinition struct {
+	ID        uuid.UUID `gorm:"type:uuid;primarykey"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	Name      string
+	Format    PayloadFormat `gorm:"type:string"`
+	Sources   datatypes.JSONSlice[DefinitionSource]
+	User
+}
+
+func (ed *ExportDefinition) BeforeCreate(tx *gorm.DB) (err error) {
+	ed.ID = uuid.New()
+	return nil
+}
+
+// NewExportPayload returns a new, pending export for the sources of the
+// definition. It still has to be created in the database.
+func (ed *ExportDefinition) NewExportPayload() *ExportPayload {
+	payload := &ExportPayload{
+		Name:   ed.Name,
+		Format: ed.Format,
+		Status: Pending,
+		User:   ed.User,
+	}
+	for _, source := range ed.Sources {
+		payload.Sources = append(payload.Sources, Source{
+			Application: source.Application,
+			Status:      RPending,
+			Resource:    source.Resource,
+			Filters:     source.Filters,
+		})
+	}
+	return payload
+}
+
+func (edb *ExportDB) CreateDefinition(definition *ExportDefinition) (*ExportDefinition, error) {
+	result := edb.DB.Create(definition)
+	return definition, result.Error
+}
+
+func (edb *ExportDB) DeleteDefinition(definitionUUID uuid.UUID, user User) error {
+	result := edb.DB.Where(&ExportDefinition{ID: definitionUUID, User: user}).Delete(&ExportDefinition{})
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (edb *ExportDB) GetDefinition(definitionUUID uuid.UUID, user User) (result *ExportDefinition, err error) {
+	err = edb.DB.Where(&ExportDefinition{ID: definitionUUID, User: user}).Take(&result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, ErrRecordNotFound
+	}
+	return
+}
+
+func (edb *ExportDB) ListDefinitions(user User, offset, limit int, sort, dir string) (result []*ExportDefinition, count int64, err error) {
+	db := edb.DB.Model(&ExportDefinition{}).Where(&ExportDefinition{User: user})
+
+	db.Count(&count)
+
+	err = db.Order(sort + " " + dir).Limit(limit).Offset(offset).Find(&result).Error
+	return
+}
+
+// UpdateDefinition replaces the name, format and sources of an existing definition.
+func (edb *ExportDB) UpdateDefinition(definition *ExportDefinition) error {
+	definition.UpdatedAt = time.Now()
+	result := edb.DB.Model(definition).
+		Where(&ExportDefinition{User: definition.User}).
+		Select("name", "format", "sources", "updated_at").
+		Updates(definition)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -19,26 +19,70 @@ import (
 type PayloadFormat string
 
 const (
-	CSV  PayloadFormat = "csv"
-	JSON PayloadFormat = "json"
+	CSV     PayloadFormat = "csv"
+	JSON    PayloadFormat = "json"
+	NDJSON  PayloadFormat = "ndjson"
+	XLSX    PayloadFormat = "xlsx"
+	Parquet PayloadFormat = "parquet"
+	PDF     PayloadFormat = "pdf"
 )
 
+// PayloadFormats are the formats that exports can be requested in.
+var PayloadFormats = []PayloadFormat{CSV, JSON, NDJSON, XLSX, Parquet, PDF}
+
+// ArchiveFormat is the container that the sources of an export are
+// compressed into.
+type ArchiveFormat string
+
+const (
+	Zip    ArchiveFormat = "zip"
+	TarGz  ArchiveFormat = "tar.gz"
+	TarZst ArchiveFormat = "tar.zst"
+)
+
+// ArchiveFormats are the containers that exports can be requested in.
+var ArchiveFormats = []ArchiveFormat{Zip, TarGz, TarZst}
+
+// EncryptionType is how the archive of an export is encrypted.
+type EncryptionType string
+
+const (
+	AgeEncryption      EncryptionType = "age"
+	PGPEncryption      EncryptionType = "pgp"
+	PasswordEncryption EncryptionType = "password"
+)
+
+// EncryptionTypes are the ways that archives can be encrypted.
+var EncryptionTypes = []EncryptionType{AgeEncryption, PGPEncryption, PasswordEncryption}
+
+// Encryption is how the archive of an export is encrypted, if its Type is
+// set. Key is the age or OpenPGP public key of the recipient, or the wrapped
+// keys which the files of an AES-256 encrypted zip are encrypted with, derived
+// from its password, which are cleared once the export is finished or
+// cancelled.
+type Encryption struct {
+	Type EncryptionType `gorm:"type:string"`
+	Key  string
+}
+
 type PayloadStatus string
 
 const (
-	Partial  PayloadStatus = "partial"
-	Pending  PayloadStatus = "pending"
-	Running  PayloadStatus = "running"
-	Complete PayloadStatus = "complete"
-	Failed   PayloadStatus = "failed"
+	Partial   PayloadStatus = "partial"
+	Pending   PayloadStatus = "pending"
+	Running   PayloadStatus = "running"
+	Complete  PayloadStatus = "complete"
+	Failed    PayloadStatus = "failed"
+	Cancelled PayloadStatus = "cancelled"
 )
 
 type ResourceStatus string
 
 const (
-	RPending ResourceStatus = "pending"
-	RComplete ResourceStatus = "complete"
-	RFailed  ResourceStatus = "failed"
+	RPending   ResourceStatus = "pending"
+	RComplete  ResourceStatus = "complete"
+	RFailed    ResourceStatus = "failed"
+	RCancelled ResourceStatus = "cancelled"
 )
 
 // QueryParams for the /export/v1/exports endpoint
@@ -60,9 +104,30 @@ type ExportPayload struct {
 	RequestID   string
 	Name        string
 	Format      PayloadFormat `gorm:"type:string"`
+	Archive     ArchiveFormat `gorm:"type:string"`
 	Status      PayloadStatus `gorm:"type:string"`
 	Sources     []Source      `gorm:"foreignKey:ExportPayloadID"`
 	S3Key       string
+	// Identity is the X-Rh-Identity header of the original request, which
+	// the applications authorize the export with. It is only kept for the
+	// automatic retries of sources whose application has a retry policy, and
+	// is forgotten once the export finishes.
+	Identity string
+	// IdempotencyKey is the Idempotency-Key header of the original request,
+	// and RequestHash a hash of its contents
+	IdempotencyKey string
+	RequestHash    string
+	// CallbackURL is notified once the export is finished, and the
+	// notification signed with CallbackSecret if it is set
+	CallbackURL    string
+	CallbackSecret string
+	// ExpiryNotifiedAt is when the lifecycle event announcing that the export
+	// expires soon was published
+	ExpiryNotifiedAt *time.Time
+	// ArchiveSize is the size in bytes of the uploaded archive, counted
+	// against the storage quota of the organization
+	ArchiveSize int64
+	Encryption  Encryption `gorm:"embedded;embeddedPrefix:encryption_"`
 	User
 }
 
@@ -73,6 +138,14 @@ type Source struct {
 	Status          ResourceStatus
 	Resource        string
 	Filters         datatypes.JSON `gorm:"type:json"`
+	Attempts        int
+	// NextAttemptAt is when a failed source is requested from its application
+	// again, as allowed by the retry policy of the application
+	NextAttemptAt *time.Time
+	// Format is the format that the application uploads the source in. It
+	// differs from the format of the export when the application cannot
+	// produce that format, and the source is converted when it is compressed.
+	Format PayloadFormat `gorm:"type:string"`
 	*SourceError
 }
 
@@ -95,9 +168,16 @@ func (ep *ExportPayload) BeforeCreate(tx *gorm.DB) (err error) {
 		expirationTime := time.Now().AddDate(0, 0, exportConfig.ExportExpiryDays)
 		ep.Expires = &expirationTime
 	}
+	if ep.Archive == "" {
+		ep.Archive = Zip
+	}
 	for i := range ep.Sources {
 		ep.Sources[i].ID = uuid.New()
 		ep.Sources[i].ExportPayloadID = ep.ID
+		ep.Sources[i].Attempts = 1
+		if ep.Sources[i].Format == "" {
+			ep.Sources[i].Format = ep.Format
+		}
 	}
 	return nil
 }
@@ -130,36 +210,105 @@ func (es *Source) GetFilters() (map[string]interface{}, error) {
 	return filters, err
 }
 
+// SetStatusComplete completes an export that has not yet finished.
+// ErrAlreadyFinished is returned if it has, e.g. because it was cancelled.
 func (ep *ExportPayload) SetStatusComplete(db DBInterface, t *time.Time, s3key string) error {
 	values := ExportPayload{
 		Status:      Complete,
 		CompletedAt: t,
 		S3Key:       s3key,
 	}
-	return db.Updates(ep, values)
+	return db.Finish(ep, values)
 }
 
+// SetStatusPartial completes an export, of which some sources failed, that
+// has not yet finished. ErrAlreadyFinished is returned if it has.
 func (ep *ExportPayload) SetStatusPartial(db DBInterface, t *time.Time, s3key string) error {
 	values := ExportPayload{
 		Status:      Partial,
 		CompletedAt: t,
 		S3Key:       s3key,
 	}
-	return db.Updates(ep, values)
+	return db.Finish(ep, values)
 }
 
+// SetArchiveSize records the size of the uploaded archive.
+func (ep *ExportPayload) SetArchiveSize(db DBInterface, size int64) error {
+	return db.Updates(ep, map[string]interface{}{"archive_size": size})
+}
+
+// SetStatusFailed fails an export that has not yet finished.
+// ErrAlreadyFinished is returned if it has.
 func (ep *ExportPayload) SetStatusFailed(db DBInterface) error {
 	t := time.Now()
 	values := ExportPayload{
 		Status:      Failed,
 		CompletedAt: &t,
 	}
-	return db.Updates(ep, values)
+	return db.Finish(ep, values)
 }
 
+// SetStatusRunning moves an export that has not yet finished to running.
+// ErrAlreadyFinished is returned if it has, e.g. because it was cancelled.
 func (ep *ExportPayload) SetStatusRunning(db DBInterface) error {
-	values := ExportPayload{Status: Running}
-	return db.Updates(ep, values)
+	return db.Start(ep)
+}
+
+// UpdateMetadata renames the export and moves its expiry. An empty name, or a
+// nil expiry, is left unchanged.
+func (ep *ExportPayload) UpdateMetadata(db DBInterface, name string, expires *time.Time) error {
+	values := map[string]interface{}{}
+	if name != "" {
+		values["name"] = name
+	}
+	if expires != nil {
+		// the new expiry is announced again once it is close
+		values["expires"] = expires
+		values["expiry_notified_at"] = nil
+	}
+	if err := db.Updates(ep, values); err != nil {
+		return err
+	}
+	if name != "" {
+		ep.Name = name
+	}
+	if expires != nil {
+		ep.Expires = expires
+	}
+	return nil
+}
+
+// SetStatusCancelled cancels an export that has not yet finished, along with
+// any of its sources that are still pending. ErrNotCancellable is returned if
+// the export has already reached a final status.
+func (ep *ExportPayload) SetStatusCancelled(db DBInterface) error {
+	return db.Cancel(ep)
+}
+
+// RetrySources moves the given failed sources back to pending so that they can be
+// requested again. The export becomes running if any of its other sources have
+// already been delivered, otherwise it is pending. The identity is kept for
+// automatic retries, and should be empty if none apply.
+func (ep *ExportPayload) RetrySources(db DBInterface, sourceIDs []uuid.UUID, identity string) error {
+	status := Pending
+	for _, source := range ep.Sources {
+		if source.Status == RComplete {
+			status = Running
+			break
+		}
+	}
+	return db.Retry(ep, sourceIDs, status, identity)
+}
+
+// ScheduleSourceRetry records that a pending source is requested from its
+// application again at the given time. The request is sent by whichever
+// scheduler claims it with ClaimDueRetries.
+func (ep *ExportPayload) ScheduleSourceRetry(db DBInterface, uid uuid.UUID, at time.Time) error {
+	_, _, err := ep.GetSource(uid)
+	if err != nil {
+		return fmt.Errorf("failed to get sources: %w", err)
+	}
+	return db.Raw("UPDATE sources SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ? AND status = ?", at, uid, RPending).Scan(&ep).Error
 }
 
 func (ep *ExportPayload) SetSourceStatus(db DBInterface, uid uuid.UUID, status ResourceStatus, sourceError *SourceError) error {
@@ -170,10 +319,10 @@ func (ep *ExportPayload) SetSourceStatus(db DBInterface, uid uuid.UUID, status R
 
 	var sql *gorm.DB
 	if sourceError == nil {
-		sql = db.Raw("UPDATE sources SET status = ? WHERE id = ?", status, uid)
+		sql = db.Raw("UPDATE sources SET status = ?, next_attempt_at = NULL WHERE id = ?", status, uid)
 	} else {
 		// the `code` and `message` are user inputs, so they are parameterized to prevent sql injection
-		sql = db.Raw("UPDATE sources SET status = ?, code = ?, message = ? WHERE id = ?", status, sourceError.Code, sourceError.Message, uid)
+		sql = db.Raw("UPDATE sources SET status = ?, code = ?, message = ?, next_attempt_at = NULL WHERE id = ?", status, sourceError.Code, sourceError.Message, uid)
 	}
 	return sql.Scan(&ep).Error
 }
@@ -184,6 +333,7 @@ const (
 	StatusPending
 	StatusPartial
 	StatusComplete
+	StatusCancelled
 )
 
 // GetAllSourcesStatus gets the status for all of the sources. This function can return these different states:
@@ -192,13 +342,14 @@ const (
 //   - StatusPending - sources are still pending
 //   - StatusPartial - sources are all complete, some sources are a failure
 //   - StatusFailed - all sources have failed
+//   - StatusCancelled - sources were cancelled, so there is nothing to zip
 func (ep *ExportPayload) GetAllSourcesStatus() (int, error) {
 	sources, err := ep.GetSources()
 	if err != nil {
 		// we do not know the status of the sources. as far as we know, there is nothing to zip.
 		return StatusError, err
 	}
-	failedCount := 0
+	failedCount, cancelledCount := 0, 0
 	for _, source := range sources {
 		switch source.Status {
 		case RPending:
@@ -206,8 +357,14 @@ func (ep *ExportPayload) GetAllSourcesStatus() (int, error) {
 			return StatusPending, nil
 		case RFailed:
 			failedCount += 1
+		case RCancelled:
+			cancelledCount += 1
 		}
 	}
+	if cancelledCount > 0 {
+		// the export was cancelled, it is never zipped.
+		return StatusCancelled, nil
+	}
 	if failedCount == len(sources) {
 		// return 2 as there is nothing to zip into a payload.
 		return StatusFailed, nil
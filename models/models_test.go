@@ -91,6 +91,62 @@ var _ = Describe("Models", func() {
 			expectedCompletionTime := *result.CompletedAt
 			Expect(expectedCompletionTime.Truncate(time.Millisecond)).Should(Equal(completionTime.Truncate(time.Millisecond)))
 		})
+
+		It("should not complete payloads which were cancelled", func() {
+			setupTest(testGormDB)
+
+			createdExport, err := exportDB.Create(exportPayload)
+			Expect(err).To(BeNil())
+			Expect(createdExport.SetStatusRunning(exportDB)).To(Succeed())
+
+			// the export is cancelled while it is compressed
+			cancelled, err := exportDB.Get(createdExport.ID)
+			Expect(err).To(BeNil())
+			Expect(cancelled.SetStatusCancelled(exportDB)).To(Succeed())
+
+			completionTime := time.Now()
+			statusUpdateErr := createdExport.SetStatusComplete(exportDB, &completionTime, "test")
+			Expect(statusUpdateErr).To(MatchError(m.ErrAlreadyFinished))
+
+			result, err := exportDB.Get(createdExport.ID)
+			Expect(err).To(BeNil())
+			Expect(result.Status).To(Equal(m.Cancelled))
+			Expect(result.S3Key).ToNot(Equal("test"))
+		})
+
+		It("should forget the password and identity of payloads once they are finished", func() {
+			setupTest(testGormDB)
+
+			exportPayload.Encryption = m.Encryption{Type: m.PasswordEncryption, Key: "wrapped"}
+			exportPayload.Identity = "identity"
+			createdExport, err := exportDB.Create(exportPayload)
+			Expect(err).To(BeNil())
+
+			completionTime := time.Now()
+			Expect(createdExport.SetStatusComplete(exportDB, &completionTime, "test")).To(Succeed())
+			Expect(createdExport.Encryption.Key).To(BeEmpty())
+			Expect(createdExport.Identity).To(BeEmpty())
+
+			result, err := exportDB.Get(createdExport.ID)
+			Expect(err).To(BeNil())
+			Expect(result.Encryption).To(Equal(m.Encryption{Type: m.PasswordEncryption}))
+			Expect(result.Identity).To(BeEmpty())
+		})
+
+		It("should forget the password and identity of payloads which are cancelled", func() {
+			setupTest(testGormDB)
+
+			exportPayload.Encryption = m.Encryption{Type: m.PasswordEncryption, Key: "wrapped"}
+			exportPayload.Identity = "identity"
+			createdExport, err := exportDB.Create(exportPayload)
+			Expect(err).To(BeNil())
+			Expect(createdExport.SetStatusCancelled(exportDB)).To(Succeed())
+
+			result, err := exportDB.Get(createdExport.ID)
+			Expect(err).To(BeNil())
+			Expect(result.Encryption.Key).To(BeEmpty())
+			Expect(result.Identity).To(BeEmpty())
+		})
 	})
 
 	Describe("SetStatusPartial", func() {
@@ -151,6 +207,20 @@ var _ = Describe("Models", func() {
 			Expect(err).To(BeNil())
 			Expect(result.Status).To(Equal(m.Running))
 		})
+
+		It("should not set payloads which were cancelled running again", func() {
+			setupTest(testGormDB)
+
+			createdExport, err := exportDB.Create(exportPayload)
+			Expect(err).To(BeNil())
+			Expect(createdExport.SetStatusCancelled(exportDB)).To(Succeed())
+
+			Expect(createdExport.SetStatusRunning(exportDB)).To(MatchError(m.ErrAlreadyFinished))
+
+			result, err := exportDB.Get(createdExport.ID)
+			Expect(err).To(BeNil())
+			Expect(result.Status).To(Equal(m.Cancelled))
+		})
 	})
 
 	Describe("SetSourceStatus", func() {
@@ -251,5 +321,14 @@ var _ = Describe("Models", func() {
 			m.StatusPartial,
 			nil,
 		),
+		Entry("should return StatusCancelled when sources were cancelled",
+			[]m.Source{
+				{Status: m.RComplete},
+				{Status: m.RCancelled},
+				{Status: m.RComplete},
+			},
+			m.StatusCancelled,
+			nil,
+		),
 	)
 })
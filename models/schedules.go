@@ -0,0 +1,217 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportSchedule runs an ExportDefinition on a cron schedule. The identity of
+// the user who created or last updated the schedule is stored so that the
+// applications receive the same identity as for an export requested through
+// the API. The identity is only used until IdentityExpiresAt, so that changes
+// to the entitlements of the user are picked up once the schedule is updated.
+type ExportSchedule struct {
+	ID                uuid.UUID `gorm:"type:uuid;primarykey"`
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
+	DefinitionID      uuid.UUID `gorm:"type:uuid"`
+	Cron              string
+	Enabled           bool
+	NextRunAt         *time.Time
+	LastRunAt         *time.Time
+	LastExportID      *uuid.UUID `gorm:"type:uuid"`
+	Identity          string
+	IdentityExpiresAt time.Time
+	// Failures is the number of runs in a row which failed, and LastError
+	// the error of the last of them. A failed run is retried with backoff.
+	Failures  int
+	LastError string
+	User
+}
+
+func (es *ExportSchedule) BeforeCreate(tx *gorm.DB) (err error) {
+	es.ID = uuid.New()
+	return nil
+}
+
+// ParseCron parses a standard five field cron expression, or one of the
+// predefined schedules such as @daily.
+func ParseCron(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	// schedules such as `0 0 30 2 *` are valid but never run
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("'%s' never runs", spec)
+	}
+	return schedule, nil
+}
+
+// Advance sets NextRunAt to the first run of the schedule after the given time.
+// Cron expressions are evaluated in UTC. A disabled schedule has no next run.
+func (es *ExportSchedule) Advance(after time.Time) error {
+	if !es.Enabled {
+		es.NextRunAt = nil
+		return nil
+	}
+	schedule, err := ParseCron(es.Cron)
+	if err != nil {
+		return err
+	}
+	next := schedule.Next(after.UTC())
+	es.NextRunAt = &next
+	return nil
+}
+
+// ScheduleRunError is returned by RunDueSchedule when the run of a schedule
+// failed. The failure has been recorded, and the schedule backed off.
+type ScheduleRunError struct {
+	ScheduleID uuid.UUID
+	Err        error
+}
+
+func (e *ScheduleRunError) Error() string {
+	return fmt.Sprintf("failed to run schedule %s: %v", e.ScheduleID, e.Err)
+}
+
+func (e *ScheduleRunError) Unwrap() error {
+	return e.Err
+}
+
+// SetIdentity stores the identity header of the user who creates or updates
+// the schedule, which is used until ttl has passed.
+func (es *ExportSchedule) SetIdentity(identity string, ttl time.Duration) {
+	es.Identity = identity
+	es.IdentityExpiresAt = time.Now().Add(ttl)
+}
+
+// IdentityExpired reports whether the identity of the schedule can no longer be
+// used at now, and the schedule has to be updated before it runs again.
+func (es *ExportSchedule) IdentityExpired(now time.Time) bool {
+	return !now.Before(es.IdentityExpiresAt)
+}
+
+// retryAt returns when a schedule is run again after its run at now failed,
+// backing off from a minute up to an hour with every failure in a row. It is
+// never later than the next regular run of the schedule.
+func (es *ExportSchedule) retryAt(now time.Time) time.Time {
+	retry := now.Add(time.Minute << min(es.Failures, 6))
+	if schedule, err := ParseCron(es.Cron); err == nil {
+		if next := schedule.Next(now.UTC()); next.Before(retry) {
+			return next
+		}
+	}
+	return retry
+}
+
+func (edb *ExportDB) CreateSchedule(schedule *ExportSchedule) (*ExportSchedule, error) {
+	result := edb.DB.Create(schedule)
+	return schedule, result.Error
+}
+
+func (edb *ExportDB) DeleteSchedule(scheduleUUID uuid.UUID, user User) error {
+	result := edb.DB.Where(&ExportSchedule{ID: scheduleUUID, User: user}).Delete(&ExportSchedule{})
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (edb *ExportDB) GetSchedule(scheduleUUID uuid.UUID, user User) (result *ExportSchedule, err error) {
+	err = edb.DB.Where(&ExportSchedule{ID: scheduleUUID, User: user}).Take(&result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, ErrRecordNotFound
+	}
+	return
+}
+
+func (edb *ExportDB) ListSchedules(user User, offset, limit int, sort, dir string) (result []*ExportSchedule, count int64, err error) {
+	db := edb.DB.Model(&ExportSchedule{}).Where(&ExportSchedule{User: user})
+
+	db.Count(&count)
+
+	err = db.Order(sort + " " + dir).Limit(limit).Offset(offset).Find(&result).Error
+	return
+}
+
+// UpdateSchedule saves every mutable field of an existing schedule.
+func (edb *ExportDB) UpdateSchedule(schedule *ExportSchedule) error {
+	schedule.UpdatedAt = time.Now()
+	result := edb.DB.Model(schedule).
+		Where(&ExportSchedule{User: schedule.User}).
+		Select("definition_id", "cron", "enabled", "next_run_at", "last_run_at", "last_export_id", "identity", "identity_expires_at", "updated_at").
+		Updates(schedule)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RunDueSchedule locks the enabled schedule that has been due the longest and
+// calls fn with it, and with an ExportDB bound to the same transaction. Rows
+// which are already locked by another replica are skipped, so each run of a
+// schedule happens only once. fn is expected to advance the schedule; if it
+// returns an error its changes are rolled back, and the failure is recorded on
+// the schedule, whose next run is backed off so that it does not hold up the
+// other due schedules. A *ScheduleRunError is then returned. RunDueSchedule
+// reports whether a due schedule was found.
+func (edb *ExportDB) RunDueSchedule(now time.Time, fn func(tx *ExportDB, schedule *ExportSchedule) error) (bool, error) {
+	found := false
+	var schedule ExportSchedule
+	var runErr error
+	err := edb.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("enabled AND next_run_at <= ?", now).
+			Order("next_run_at").
+			Take(&schedule).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		found = true
+		failed := schedule
+		// the run is rolled back to a savepoint if it fails
+		runErr = tx.Transaction(func(tx *gorm.DB) error {
+			return fn(&ExportDB{DB: tx, Cfg: edb.Cfg}, &schedule)
+		})
+		if runErr == nil {
+			if failed.Failures == 0 {
+				return nil
+			}
+			return tx.Model(&ExportSchedule{}).
+				Where("id = ?", schedule.ID).
+				Updates(map[string]interface{}{"failures": 0, "last_error": ""}).
+				Error
+		}
+
+		return tx.Model(&ExportSchedule{}).
+			Where("id = ?", failed.ID).
+			Updates(map[string]interface{}{
+				"failures":    failed.Failures + 1,
+				"last_error":  runErr.Error(),
+				"next_run_at": failed.retryAt(now),
+			}).
+			Error
+	})
+	if err != nil {
+		return found, err
+	}
+	if runErr != nil {
+		return found, &ScheduleRunError{ScheduleID: schedule.ID, Err: runErr}
+	}
+	return found, nil
+}
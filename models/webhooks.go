@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookDelivery records a single attempt to notify the callback URL of an
+// export. All attempts of the same notification share a DeliveryID.
+type WebhookDelivery struct {
+	ID              uuid.UUID `gorm:"type:uuid;primarykey"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	ExportPayloadID uuid.UUID `gorm:"type:uuid"`
+	DeliveryID      uuid.UUID `gorm:"type:uuid"`
+	URL             string
+	// Status is the status of the export the notification was sent for
+	Status     PayloadStatus `gorm:"type:string"`
+	Attempt    int
+	StatusCode int
+	Error      string
+	Delivered  bool
+}
+
+func (wd *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	wd.ID = uuid.New()
+	return nil
+}
+
+func (edb *ExportDB) CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	return edb.DB.Create(delivery).Error
+}
+
+// ListWebhookDeliveries returns every delivery attempt of an export, oldest
+// first.
+func (edb *ExportDB) ListWebhookDeliveries(exportUUID uuid.UUID) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	result := edb.DB.Where(&WebhookDelivery{ExportPayloadID: exportUUID}).Order("created_at, attempt").Find(&deliveries)
+	return deliveries, result.Error
+}
@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	econfig "github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// ArchiveWriter writes the files of an export into an archive.
+type ArchiveWriter interface {
+	// Create adds a file of the given size to the archive. Its contents
+	// have to be written to the returned writer before the next file is
+	// created.
+	Create(name string, size int64, modTime time.Time) (io.Writer, error)
+	// Close finishes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// NewArchiveWriter returns an ArchiveWriter which writes an archive of the
+// given format to w, compressed at the configured level.
+func NewArchiveWriter(w io.Writer, format models.ArchiveFormat, cfg econfig.ExportConfig) (ArchiveWriter, error) {
+	levels := cfg.ArchiveConfig
+
+	switch format {
+	case models.Zip, "":
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, levels.ZipLevel)
+		})
+		return &zipArchiveWriter{zw}, nil
+	case models.TarGz:
+		gw, err := gzip.NewWriterLevel(w, levels.GzipLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{tar.NewWriter(gw), gw}, nil
+	case models.TarZst:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(levels.ZstdLevel)))
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{tar.NewWriter(zw), zw}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %s", format)
+	}
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate, // DEFLATE compressed
+		Modified: modTime,
+	}
+	header.SetMode(0644)
+	return a.zw.CreateHeader(header)
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// tarArchiveWriter writes a tarball through a compressor, such as gzip.
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (a *tarArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return a.tw, nil
+}
+
+func (a *tarArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.compressor.Close()
+}
+
+// archiveExtension returns the file extension of archives of the format.
+func archiveExtension(format models.ArchiveFormat) string {
+	if format == "" {
+		return string(models.Zip)
+	}
+	return string(format)
+}
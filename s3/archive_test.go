@@ -0,0 +1,185 @@
+package s3_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/s3"
+)
+
+var _ = Describe("Writing archives", func() {
+	files := map[string]string{
+		"data.json": `[{"id": 1}]`,
+		"README.md": "# Export",
+	}
+
+	write := func(format models.ArchiveFormat) []byte {
+		var buf bytes.Buffer
+		archive, err := s3.NewArchiveWriter(&buf, format, *config.Get())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for _, name := range []string{"data.json", "README.md"} {
+			w, err := archive.Create(name, int64(len(files[name])), time.Now())
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = io.WriteString(w, files[name])
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(archive.Close()).To(Succeed())
+		return buf.Bytes()
+	}
+
+	readTar := func(r io.Reader) map[string]string {
+		contents := make(map[string]string)
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return contents
+			}
+			Expect(err).ShouldNot(HaveOccurred())
+			b, err := io.ReadAll(tr)
+			Expect(err).ShouldNot(HaveOccurred())
+			contents[header.Name] = string(b)
+		}
+	}
+
+	It("writes zip archives", func() {
+		data := write(models.Zip)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		contents := make(map[string]string)
+		for _, f := range zr.File {
+			Expect(f.Method).To(Equal(zip.Deflate))
+			rc, err := f.Open()
+			Expect(err).ShouldNot(HaveOccurred())
+			b, err := io.ReadAll(rc)
+			Expect(err).ShouldNot(HaveOccurred())
+			contents[f.Name] = string(b)
+		}
+		Expect(contents).To(Equal(files))
+	})
+
+	It("writes gzipped tarballs", func() {
+		gr, err := gzip.NewReader(bytes.NewReader(write(models.TarGz)))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(readTar(gr)).To(Equal(files))
+	})
+
+	It("writes zstd compressed tarballs", func() {
+		zr, err := zstd.NewReader(bytes.NewReader(write(models.TarZst)))
+		Expect(err).ShouldNot(HaveOccurred())
+		defer zr.Close()
+		Expect(readTar(zr)).To(Equal(files))
+	})
+
+	It("compresses at the configured level", func() {
+		cfg := config.Get()
+		levels := cfg.ArchiveConfig
+		DeferCleanup(func() { cfg.ArchiveConfig = levels })
+
+		cfg.ArchiveConfig.GzipLevel = gzip.NoCompression
+		gr, err := gzip.NewReader(bytes.NewReader(write(models.TarGz)))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(readTar(gr)).To(Equal(files))
+	})
+
+	It("rejects unknown formats", func() {
+		_, err := s3.NewArchiveWriter(&bytes.Buffer{}, "rar", *config.Get())
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when archives are larger than memory", func() {
+		const size = 5 << 30 // beyond the 4 GiB limit of zips without zip64
+
+		BeforeEach(func() {
+			cfg := config.Get()
+			levels := cfg.ArchiveConfig
+			DeferCleanup(func() { cfg.ArchiveConfig = levels })
+			cfg.ArchiveConfig.ZipLevel = flate.BestSpeed
+			cfg.ArchiveConfig.GzipLevel = gzip.BestSpeed
+		})
+
+		// stream writes a file of size zeros to an archive, and returns the
+		// archive and the peak heap in use while it was written.
+		stream := func(format models.ArchiveFormat) ([]byte, uint64) {
+			var buf bytes.Buffer
+			archive, err := s3.NewArchiveWriter(&buf, format, *config.Get())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			w, err := archive.Create("data.json", size, time.Now())
+			Expect(err).ShouldNot(HaveOccurred())
+			data := &heapWatcher{r: io.LimitReader(zeros{}, size)}
+			Expect(io.Copy(w, data)).To(BeEquivalentTo(size))
+			Expect(archive.Close()).To(Succeed())
+			return buf.Bytes(), data.peak
+		}
+
+		It("streams zips with zip64", func() {
+			data, peak := stream(models.Zip)
+			Expect(peak).To(BeNumerically("<", 256<<20))
+
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(zr.File).To(HaveLen(1))
+			Expect(zr.File[0].UncompressedSize64).To(BeEquivalentTo(size))
+
+			rc, err := zr.File[0].Open()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(io.Copy(io.Discard, rc)).To(BeEquivalentTo(size))
+			Expect(rc.Close()).To(Succeed())
+		})
+
+		It("streams tarballs", func() {
+			data, peak := stream(models.TarGz)
+			Expect(peak).To(BeNumerically("<", 256<<20))
+
+			gr, err := gzip.NewReader(bytes.NewReader(data))
+			Expect(err).ShouldNot(HaveOccurred())
+			tr := tar.NewReader(gr)
+			header, err := tr.Next()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(header.Size).To(BeEquivalentTo(size))
+			Expect(io.Copy(io.Discard, tr)).To(BeEquivalentTo(size))
+		})
+	})
+})
+
+// zeros reads an endless stream of zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// heapWatcher records the peak heap in use while it is read.
+type heapWatcher struct {
+	r          io.Reader
+	read, next int64
+	peak       uint64
+}
+
+func (h *heapWatcher) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.read += int64(n)
+	if h.read >= h.next {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		h.peak = max(h.peak, stats.HeapInuse)
+		h.next += 64 << 20
+	}
+	return n, err
+}
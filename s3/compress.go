@@ -1,21 +1,27 @@
 package s3
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	econfig "github.com/redhatinsights/export-service-go/config"
 
@@ -25,12 +31,32 @@ import (
 
 const formatDateTime = "2006-01-02T15:04:05Z" // ISO 8601
 
+// ErrObjectChanged is returned by GetObject when the object no longer has the
+// ETag it was expected to have, because it was replaced.
+var ErrObjectChanged = errors.New("the object was changed")
+
 type Compressor struct {
-	Bucket     string
-	Log        *zap.SugaredLogger
-	Client     s3.Client
-	Cfg        econfig.ExportConfig
-	TMClient   *transfermanager.Client
+	Bucket   string
+	Log      *zap.SugaredLogger
+	Client   s3.Client
+	Cfg      econfig.ExportConfig
+	TMClient *transfermanager.Client
+	// Notifiers are told about every export that is finished
+	Notifiers []ExportNotifier
+
+	// compressing tracks the exports which are being compressed
+	compressing sync.WaitGroup
+}
+
+// Wait waits until every export which is being compressed is finished, and
+// its notifiers have been told.
+func (c *Compressor) Wait() {
+	c.compressing.Wait()
+}
+
+// ExportNotifier is told whenever an export reaches a final status.
+type ExportNotifier interface {
+	ExportFinished(exportID uuid.UUID)
 }
 
 // S3ListObjectsAPI defines the interface for the ListObjectsV2 function.
@@ -47,7 +73,10 @@ type StorageHandler interface {
 	Download(ctx context.Context, logger *zap.SugaredLogger, w io.WriterAt, bucket, key *string) (n int64, err error)
 	Upload(ctx context.Context, logger *zap.SugaredLogger, body io.Reader, bucket, key *string) (*transfermanager.UploadObjectOutput, error)
 	CreateObject(ctx context.Context, logger *zap.SugaredLogger, db models.DBInterface, body io.Reader, application string, resourceUUID uuid.UUID, payload *models.ExportPayload) error
-	GetObject(ctx context.Context, logger *zap.SugaredLogger, key string) (io.ReadCloser, error)
+	GetObject(ctx context.Context, logger *zap.SugaredLogger, key, byteRange, ifMatch string) (io.ReadCloser, error)
+	HeadObject(ctx context.Context, logger *zap.SugaredLogger, key string) (*ObjectInfo, error)
+	PresignGetObject(ctx context.Context, logger *zap.SugaredLogger, key, filename string, expires time.Duration) (string, error)
+	DeleteObject(ctx context.Context, logger *zap.SugaredLogger, key string) error
 	ProcessSources(db models.DBInterface, uid uuid.UUID)
 }
 
@@ -55,7 +84,28 @@ func GetObjects(c context.Context, api S3ListObjectsAPI, input *s3.ListObjectsV2
 	return api.ListObjectsV2(c, input)
 }
 
-func (c *Compressor) zipExport(ctx context.Context, logger *zap.SugaredLogger, prefix, filename, s3key string, meta ExportMeta, sources []models.Source) error {
+// ListObjects lists every object in the bucket under prefix. ListObjectsV2
+// returns at most 1000 objects at a time, so the listing is continued until
+// the last page.
+func ListObjects(ctx context.Context, api S3ListObjectsAPI, bucket, prefix string) ([]types.Object, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	}
+
+	var objects []types.Object
+	paginator := s3.NewListObjectsV2Paginator(api, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket objects: %w", err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+	return objects, nil
+}
+
+func (c *Compressor) zipExport(ctx context.Context, logger *zap.SugaredLogger, prefix, filename, s3key string, meta ExportMeta, sources []models.Source, format models.PayloadFormat, archive models.ArchiveFormat, encryption models.Encryption) error {
 	// Use this temp directory for all temp files
 	tempDirName, err := os.MkdirTemp("", filename)
 	if err != nil {
@@ -73,73 +123,127 @@ func (c *Compressor) zipExport(ctx context.Context, logger *zap.SugaredLogger, p
 	if err != nil {
 		return err
 	}
+	// the files are closed once they are archived, before the temp
+	// directory is removed. convertFiles replaces files in this slice, so
+	// the converted files are closed as well.
+	defer closeFiles(logger, downloadedFiles)
 
-	fileMetadata, err := buildFileMetadata(downloadedFiles, sources)
+	downloadedFiles, err = convertFiles(logger, downloadedFiles, sources, format, meta, tempDirName)
 	if err != nil {
 		return err
 	}
 
-	meta.FileMeta = fileMetadata
-
-	zippedBuffer, err := writeFilesToZip(logger, downloadedFiles, meta)
+	fileMetadata, err := buildFileMetadata(downloadedFiles, sources)
 	if err != nil {
 		return err
 	}
 
-	tempExportFile, err := writeBufferToTempFile(logger, zippedBuffer, filename, tempDirName)
-	if err != nil {
-		return err
-	}
+	meta.FileMeta = fileMetadata
 
 	logger.Infof("shipping %s to s3", filename)
-	if _, err := c.Upload(ctx, logger, tempExportFile, &c.Cfg.StorageConfig.Bucket, &s3key); err != nil {
-		return fmt.Errorf("failed to upload zip file `%s` to s3: %w", s3key, err)
+	return c.uploadArchive(ctx, logger, downloadedFiles, meta, archive, encryption, s3key)
+}
+
+// uploadArchive archives the files with the metadata of the export, and
+// uploads the archive under s3key while it is being written.
+func (c *Compressor) uploadArchive(ctx context.Context, logger *zap.SugaredLogger, files []s3FileData, meta ExportMeta, archive models.ArchiveFormat, encryption models.Encryption, s3key string) error {
+	err := pipeArchive(
+		func(w io.Writer) error {
+			return writeFilesToArchive(logger, c.Cfg, archive, encryption, files, meta, w)
+		},
+		func(r io.Reader) error {
+			_, err := c.Upload(ctx, logger, r, &c.Cfg.StorageConfig.Bucket, &s3key)
+			return err
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upload archive `%s` to s3: %w", s3key, err)
 	}
 
 	return nil
 }
 
+// pipeArchive uploads the archive written by write with upload while it is
+// being written, so that the archive is never held in memory or on disk as a
+// whole. It returns once both are done.
+func pipeArchive(write func(w io.Writer) error, upload func(r io.Reader) error) error {
+	pr, pw := io.Pipe()
+
+	written := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		// the upload reads the error, or the end of the archive
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	uploadErr := upload(pr)
+	// unblock the writer if the upload stopped reading early
+	pr.CloseWithError(fmt.Errorf("the upload of the archive stopped: %w", uploadErr))
+
+	if err := <-written; err != nil {
+		return err
+	}
+	return uploadErr
+}
+
 type s3FileData struct {
 	file     *os.File
 	basename string
 }
 
-func downloadFilesFromS3(ctx context.Context, cfg econfig.ExportConfig, log *zap.SugaredLogger, tmClient *transfermanager.Client, bucket string, prefix string, tempDir string) ([]s3FileData, error) {
-	input := &s3.ListObjectsV2Input{
-		Bucket: &bucket,
-		Prefix: &prefix,
+// closeFiles closes the files which were opened, and logs those which could
+// not be closed.
+func closeFiles(log *zap.SugaredLogger, files []s3FileData) {
+	for _, f := range files {
+		if f.file == nil {
+			continue
+		}
+		if err := f.file.Close(); err != nil {
+			log.Errorf("warning: failed to close temporary file %s: %v", f.file.Name(), err)
+		}
 	}
+}
 
+func downloadFilesFromS3(ctx context.Context, cfg econfig.ExportConfig, log *zap.SugaredLogger, tmClient *transfermanager.Client, bucket string, prefix string, tempDir string) ([]s3FileData, error) {
 	s3client := NewS3Client(cfg, log)
 
-	resp, err := GetObjects(ctx, s3client, input)
+	objects, err := ListObjects(ctx, s3client, bucket, prefix)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list bucket objects: %w", err)
+		return nil, err
 	}
 
-	if len(resp.Contents) < 1 {
-		return nil, fmt.Errorf("failed to list bucket objects: %w", err)
+	if len(objects) < 1 {
+		return nil, fmt.Errorf("no bucket objects found under %s", prefix)
 	}
 
-	downloadedFiles := make([]s3FileData, 0, len(resp.Contents))
-
-	for _, obj := range resp.Contents {
+	// the files keep the order of the objects, whichever download finishes first
+	downloadedFiles := make([]s3FileData, len(objects))
 
-		log.Infof("downloading s3://%s/%s...", bucket, *obj.Key)
-		basename := filepath.Base(*obj.Key)
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(cfg.StorageConfig.DownloadConcurrency, 1))
+	for i, obj := range objects {
+		g.Go(func() error {
+			log.Infof("downloading s3://%s/%s...", bucket, *obj.Key)
+			basename := filepath.Base(*obj.Key)
 
-		f, err := os.CreateTemp(tempDir, basename)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create temp file: %w", err)
-		}
+			f, err := os.CreateTemp(tempDir, basename)
+			if err != nil {
+				return fmt.Errorf("failed to create temp file: %w", err)
+			}
+			downloadedFiles[i] = s3FileData{f, basename}
 
-		input := &transfermanager.DownloadObjectInput{Bucket: &bucket, Key: obj.Key, WriterAt: f}
+			input := &transfermanager.DownloadObjectInput{Bucket: &bucket, Key: obj.Key, WriterAt: f}
 
-		if _, err := tmClient.DownloadObject(ctx, input); err != nil {
-			return nil, fmt.Errorf("failed to download to file: %w", err)
-		}
-
-		downloadedFiles = append(downloadedFiles, s3FileData{f, basename})
+			if _, err := tmClient.DownloadObject(ctx, input); err != nil {
+				return fmt.Errorf("failed to download to file: %w", err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		closeFiles(log, downloadedFiles)
+		return nil, err
 	}
 
 	return downloadedFiles, nil
@@ -163,98 +267,140 @@ func buildFileMetadata(files []s3FileData, sources []models.Source) ([]ExportFil
 	return fileMeta, nil
 }
 
-func writeFilesToZip(log *zap.SugaredLogger, files []s3FileData, meta ExportMeta) (*bytes.Buffer, error) {
-	var buf bytes.Buffer
-	zipWriter := zip.NewWriter(&buf)
+// writeFilesToArchive writes the files, followed by the metadata files, into
+// an archive of the given format which is written to w. Zips are encrypted
+// with the keys of encryption, which are unwrapped with the password key, if
+// it is password encryption, and the archive is encrypted as a whole with age
+// or OpenPGP keys.
+func writeFilesToArchive(log *zap.SugaredLogger, cfg econfig.ExportConfig, format models.ArchiveFormat, encryption models.Encryption, files []s3FileData, meta ExportMeta, w io.Writer) error {
+	var encrypted io.WriteCloser
+	if encryption.Type == models.AgeEncryption || encryption.Type == models.PGPEncryption {
+		var err error
+		if encrypted, err = NewEncryptionWriter(w, encryption); err != nil {
+			return fmt.Errorf("failed to encrypt archive: %w", err)
+		}
+		w = encrypted
+	}
 
-	defer func() {
-		if err := zipWriter.Close(); err != nil {
-			log.Errorf("warning: failed to write files to zip: %v", err)
+	var archive ArchiveWriter
+	if encryption.Type == models.PasswordEncryption {
+		if encryption.Key == "" {
+			return fmt.Errorf("the keys of the archive are no longer available")
 		}
-	}()
+		keys, err := UnwrapZipKeys(cfg.ArchiveConfig.PasswordKey, encryption.Key)
+		if err != nil {
+			return err
+		}
+		archive = NewPasswordZipWriter(w, keys)
+	} else {
+		var err error
+		if archive, err = NewArchiveWriter(w, format, cfg); err != nil {
+			return err
+		}
+	}
 
 	for _, f := range files {
 
 		fi, err := f.file.Stat()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get file info: %w", err)
+			return fmt.Errorf("failed to get file info: %w", err)
 		}
 
-		header, err := zip.FileInfoHeader(fi)
+		archivedFile, err := archive.Create(f.basename, fi.Size(), fi.ModTime())
 		if err != nil {
-			return nil, fmt.Errorf("failed to create file header: %w", err)
+			return fmt.Errorf("failed to write header: %w", err)
 		}
-		header.Name = f.basename
-		header.Method = zip.Deflate // DEFLATE compressed
 
-		var zippedFile io.Writer
-		if zippedFile, err = zipWriter.CreateHeader(header); err != nil {
-			return nil, fmt.Errorf("failed to write header: %w", err)
+		checksum := sha256.New()
+		size, err := io.Copy(io.MultiWriter(archivedFile, checksum), f.file)
+		if err != nil {
+			return fmt.Errorf("failed to copy data into archive: %w", err)
 		}
-
-		if _, err := io.Copy(zippedFile, f.file); err != nil {
-			return nil, fmt.Errorf("failed to copy data into zip file: %w", err)
+		for i := range meta.FileMeta {
+			if meta.FileMeta[i].Filename == f.basename {
+				meta.FileMeta[i].Size = size
+				meta.FileMeta[i].SHA256 = hex.EncodeToString(checksum.Sum(nil))
+			}
 		}
 
 		log.Infof("added file %s to payload", f.basename)
 
 	}
 
-	if err := addMetadataFilesToZip(&meta, zipWriter); err != nil {
-		return nil, err
+	if err := addMetadataFilesToArchive(&meta, archive, cfg.ArchiveConfig.SigningKey); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write files to archive: %w", err)
 	}
 
-	return &buf, nil
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt archive: %w", err)
+		}
+		log.Infof("encrypted the archive with %s", encryption.Type)
+	}
+
+	return nil
 }
 
-func writeBufferToTempFile(log *zap.SugaredLogger, buf *bytes.Buffer, filename string, tempDir string) (*os.File, error) {
-	f, err := os.CreateTemp(tempDir, filename)
+// addMetadataFilesToArchive adds the meta.json, README.md and errors.json of
+// the export to the archive, and the signature of meta.json if signingKey is
+// set. The checksums of README.md and errors.json are recorded in meta.json.
+func addMetadataFilesToArchive(meta *ExportMeta, archive ArchiveWriter, signingKey ed25519.PrivateKey) error {
+	readme, err := BuildReadme(meta)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
+		return fmt.Errorf("failed to build README.md: %w", err)
 	}
 
-	if _, err := io.Copy(f, buf); err != nil {
-		return nil, fmt.Errorf("failed to copy buffer into file: %w", err)
+	errorsJSON, err := BuildErrors(meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal errors: %w", err)
 	}
 
-	log.Infof("saving temp file %s", filename)
-
-	// seek to the beginning of the file so that we can reuse the file handler for upload
-	if _, err := f.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("failed to seek to beginning of file: %w", err)
+	meta.MetadataFiles = nil
+	for _, file := range []struct {
+		name string
+		body []byte
+	}{{"README.md", []byte(readme)}, {"errors.json", errorsJSON}} {
+		checksum := sha256.Sum256(file.body)
+		meta.MetadataFiles = append(meta.MetadataFiles, MetadataFileMeta{
+			Filename: file.name,
+			Size:     int64(len(file.body)),
+			SHA256:   hex.EncodeToString(checksum[:]),
+		})
 	}
 
-	return f, nil
-}
-
-func addMetadataFilesToZip(meta *ExportMeta, zipWriter *zip.Writer) error {
 	metaJSON, err := BuildMeta(meta)
 	if err != nil {
 		return fmt.Errorf("failed to marshal meta struct: %w", err)
 	}
 
-	readme, err := BuildReadme(meta)
-	if err != nil {
-		return fmt.Errorf("failed to build README.md: %w", err)
-	}
-
 	metadataFiles := []struct {
 		Name string
 		Body []byte
 	}{
-		{"meta.json", metaJSON},
+		{metaFilename, metaJSON},
 		{"README.md", []byte(readme)},
+		{"errors.json", errorsJSON},
+	}
+	if signingKey != nil {
+		metadataFiles = append(metadataFiles, struct {
+			Name string
+			Body []byte
+		}{signatureFilename, SignMeta(metaJSON, signingKey)})
 	}
 
 	for _, fileToAdd := range metadataFiles {
-		zipFile, err := zipWriter.Create(fileToAdd.Name)
+		archivedFile, err := archive.Create(fileToAdd.Name, int64(len(fileToAdd.Body)), time.Now())
 		if err != nil {
-			return fmt.Errorf("failed to create file %s in zip file: %w", fileToAdd.Name, err)
+			return fmt.Errorf("failed to create file %s in archive: %w", fileToAdd.Name, err)
 		}
 
-		_, err = zipFile.Write(fileToAdd.Body)
+		_, err = archivedFile.Write(fileToAdd.Body)
 		if err != nil {
-			return fmt.Errorf("failed to write file %s to zip file: %w", fileToAdd.Name, err)
+			return fmt.Errorf("failed to write file %s to archive: %w", fileToAdd.Name, err)
 		}
 	}
 
@@ -266,7 +412,7 @@ func (c *Compressor) Compress(ctx context.Context, logger *zap.SugaredLogger, m
 
 	logger.Infof("starting payload compression for %s", m.ID)
 	prefix := fmt.Sprintf("%s/%s/", m.OrganizationID, m.ID)
-	filename := fmt.Sprintf("%s-%s.zip", t.UTC().Format(formatDateTime), m.ID.String())
+	filename := fmt.Sprintf("%s-%s.%s%s", t.UTC().Format(formatDateTime), m.ID.String(), archiveExtension(m.Archive), encryptionExtension(m.Encryption.Type))
 	s3key := fmt.Sprintf("%s/%s", m.OrganizationID, filename)
 
 	sources, err := m.GetSources()
@@ -279,9 +425,11 @@ func (c *Compressor) Compress(ctx context.Context, logger *zap.SugaredLogger, m
 		ExportDate:  m.CreatedAt.UTC().Format(formatDateTime),
 		ExportOrgID: m.OrganizationID,
 		HelpString:  helpString,
+		FailedFiles: BuildFailedFiles(sources),
 	}
 
-	err = c.zipExport(ctx, logger, prefix, filename, s3key, meta, sources)
+	err = c.zipExport(ctx, logger, prefix, filename, s3key, meta, sources, m.Format, m.Archive, m.Encryption)
+	compressionDuration.With(prometheus.Labels{"archive": string(m.Archive)}).Observe(time.Since(t).Seconds())
 	return t, filename, s3key, err
 }
 
@@ -325,6 +473,13 @@ func (c *Compressor) Upload(ctx context.Context, logger *zap.SugaredLogger, body
 	return result, nil
 }
 
+// DeleteObject deletes the object stored under key, such as an archive which
+// is no longer needed.
+func (c *Compressor) DeleteObject(ctx context.Context, logger *zap.SugaredLogger, key string) error {
+	_, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &c.Bucket, Key: &key})
+	return err
+}
+
 func getUploadSize(ctx context.Context, s3client *s3.Client, bucket, key *string) (int64, error) {
 	headObj := &s3.HeadObjectInput{
 		Bucket: bucket,
@@ -338,10 +493,23 @@ func getUploadSize(ctx context.Context, s3client *s3.Client, bucket, key *string
 	return *headObjOutput.ContentLength, nil
 }
 
+// SourceKey returns the key under which the data uploaded for a source of the
+// export is stored, i.e. `{org}/{export}/{source}.{format}`, where format is
+// the format of the source.
+func SourceKey(payload *models.ExportPayload, source models.Source) string {
+	return fmt.Sprintf("%s/%s/%s.%s", payload.OrganizationID, payload.ID, source.ID, source.Format)
+}
+
 func (c *Compressor) CreateObject(ctx context.Context, logger *zap.SugaredLogger, db models.DBInterface, body io.Reader, application string, resourceUUID uuid.UUID, payload *models.ExportPayload) error {
-	filename := fmt.Sprintf("%s/%s/%s.%s", payload.OrganizationID, payload.ID, resourceUUID, payload.Format)
+	_, source, err := payload.GetSource(resourceUUID)
+	if err != nil {
+		return err
+	}
+	filename := SourceKey(payload, *source)
 
-	if err := payload.SetStatusRunning(db); err != nil {
+	if err := payload.SetStatusRunning(db); errors.Is(err, models.ErrAlreadyFinished) {
+		return err
+	} else if err != nil {
 		logger.Errorw("failed to set running status", "error", err)
 		return err
 	}
@@ -364,24 +532,83 @@ func (c *Compressor) CreateObject(ctx context.Context, logger *zap.SugaredLogger
 	return nil
 }
 
-func (c *Compressor) GetObject(ctx context.Context, logger *zap.SugaredLogger, key string) (io.ReadCloser, error) {
+// GetObject returns the body of the object stored under key. When byteRange is
+// set (e.g. `bytes=0-1023`) only that part of the object is returned. When
+// ifMatch is set, the object is only returned if it still has that ETag, and
+// ErrObjectChanged is returned otherwise.
+func (c *Compressor) GetObject(ctx context.Context, logger *zap.SugaredLogger, key, byteRange, ifMatch string) (io.ReadCloser, error) {
 	input := &s3.GetObjectInput{Bucket: &c.Bucket, Key: &key}
-	// return GetObject(ctx, &c.Client, input)
+	if byteRange != "" {
+		input.Range = &byteRange
+	}
+	if ifMatch != "" {
+		input.IfMatch = &ifMatch
+	}
 	s3Object, err := GetObject(ctx, &c.Client, input)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" {
+		return nil, ErrObjectChanged
+	}
 	if err != nil {
 		return nil, err
 	}
 	return s3Object.Body, err
 }
 
+// HeadObject returns the metadata of the object stored under key without
+// fetching its body.
+func (c *Compressor) HeadObject(ctx context.Context, logger *zap.SugaredLogger, key string) (*ObjectInfo, error) {
+	out, err := c.Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &c.Bucket, Key: &key})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ObjectInfo{}
+	if out.ContentLength != nil {
+		info.ContentLength = *out.ContentLength
+	}
+	if out.ETag != nil {
+		info.ETag = *out.ETag
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
+	}
+	return info, nil
+}
+
+// PresignGetObject returns a URL that allows the object stored under key to be
+// downloaded directly from S3 until expires has passed. The object is served as
+// an attachment named filename.
+func (c *Compressor) PresignGetObject(ctx context.Context, logger *zap.SugaredLogger, key, filename string, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(&c.Client, func(o *s3.PresignOptions) {
+		o.Expires = expires
+	})
+
+	disposition := fmt.Sprintf("attachment; filename=\"%s\"", filename)
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     &c.Bucket,
+		Key:                        &key,
+		ResponseContentDisposition: &disposition,
+	})
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
 func (c *Compressor) compressPayload(logger *zap.SugaredLogger, db models.DBInterface, payload *models.ExportPayload) {
 	t, filename, s3key, err := c.Compress(context.TODO(), logger, payload)
 	if err != nil {
 		logger.Errorw("failed to compress payload", "error", err)
-		if err := payload.SetStatusFailed(db); err != nil {
+		if err := payload.SetStatusFailed(db); errors.Is(err, models.ErrAlreadyFinished) {
+			logger.Infow("export finished while it was compressed, it has most likely been cancelled")
+			return
+		} else if err != nil {
 			logger.Errorw("failed to set status failed", "error", err)
 			return
 		}
+		c.notify(payload)
+		return
 	}
 
 	logger.Infof("done uploading %s", filename)
@@ -396,12 +623,55 @@ func (c *Compressor) compressPayload(logger *zap.SugaredLogger, db models.DBInte
 		err = payload.SetStatusComplete(db, &t, s3key)
 	case models.StatusPartial:
 		err = payload.SetStatusPartial(db, &t, s3key)
+	default:
+		logger.Infow("sources are no longer ready, not completing export", "sources_status", ready)
+		return
 	}
 
-	if err != nil {
+	if errors.Is(err, models.ErrAlreadyFinished) {
+		// the export was cancelled while it was compressed, so its archive is
+		// never downloaded
+		logger.Infow("export has been cancelled, deleting its archive")
+		if err := c.DeleteObject(context.TODO(), logger, s3key); err != nil {
+			logger.Errorw("failed to delete the archive of the cancelled export", "key", s3key, "error", err)
+		}
+		return
+	} else if err != nil {
 		logger.Errorw("failed updating model status", "error", err)
 		return
 	}
+
+	if payload.Encryption.Type != "" {
+		c.removeCleartext(context.TODO(), logger, payload)
+	}
+	if info, err := c.HeadObject(context.TODO(), logger, s3key); err != nil {
+		logger.Warnw("failed to get archive size", "error", err)
+	} else if err := payload.SetArchiveSize(db, info.ContentLength); err != nil {
+		logger.Errorw("failed to set archive size", "error", err)
+	}
+	c.notify(payload)
+}
+
+// removeCleartext deletes the data uploaded for the sources of an encrypted
+// export once the encrypted archive is uploaded.
+func (c *Compressor) removeCleartext(ctx context.Context, logger *zap.SugaredLogger, payload *models.ExportPayload) {
+	prefix := fmt.Sprintf("%s/%s/", payload.OrganizationID, payload.ID)
+	objects, err := ListObjects(ctx, &c.Client, c.Bucket, prefix)
+	if err != nil {
+		logger.Errorw("failed to list the sources of an encrypted export", "error", err)
+		return
+	}
+	for _, obj := range objects {
+		if _, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &c.Bucket, Key: obj.Key}); err != nil {
+			logger.Errorw("failed to delete the source of an encrypted export", "key", *obj.Key, "error", err)
+		}
+	}
+}
+
+func (c *Compressor) notify(payload *models.ExportPayload) {
+	for _, notifier := range c.Notifiers {
+		notifier.ExportFinished(payload.ID)
+	}
 }
 
 func (c *Compressor) ProcessSources(db models.DBInterface, uid uuid.UUID) {
@@ -421,22 +691,48 @@ func (c *Compressor) ProcessSources(db models.DBInterface, uid uuid.UUID) {
 	case models.StatusComplete, models.StatusPartial:
 		if payload.Status == models.Running {
 			logger.Infow("ready for zipping", "export-uuid", payload.ID)
-			go c.compressPayload(logger, db, payload) // start a go-routine to not block
+			c.compressing.Add(1)
+			go func() { // start a go-routine to not block
+				defer c.compressing.Done()
+				c.compressPayload(logger, db, payload)
+			}()
 		}
 	case models.StatusPending:
 		return
+	case models.StatusCancelled:
+		logger.Infow("export was cancelled, not zipping it")
+		return
 	case models.StatusFailed:
 		logger.Infof("all sources for payload %s reported as failure", payload.ID)
-		if err := payload.SetStatusFailed(db); err != nil {
+		if err := payload.SetStatusFailed(db); errors.Is(err, models.ErrAlreadyFinished) {
+			// the export has already failed, or was cancelled
+			return
+		} else if err != nil {
 			logger.Errorw("failed updating model status after sources failed", "error", err)
+			return
 		}
+		c.notify(payload)
 	}
 }
 
 type (
-	MockStorageHandler struct{}
+	MockStorageHandler struct {
+		// DeletedKeys are the keys of the objects deleted through the mock
+		DeletedKeys []string
+		// Replaced makes the object appear to be replaced between its HeadObject
+		// and its GetObject
+		Replaced bool
+	}
 )
 
+// The object served by MockStorageHandler for every key.
+const (
+	MockObjectBody = "mock export object"
+	MockObjectETag = `"5d41402abc4b2a76b9719d911017c592"`
+)
+
+var MockObjectLastModified = time.Date(2022, time.October, 12, 15, 7, 12, 0, time.UTC)
+
 func (mc *MockStorageHandler) Compress(ctx context.Context, l *zap.SugaredLogger, m *models.ExportPayload) (time.Time, string, string, error) {
 	fmt.Println("Ran mockStorageHandler.Compress")
 	return time.Now(), "filename", "s3key", nil
@@ -455,6 +751,10 @@ func (mc *MockStorageHandler) Upload(ctx context.Context, l *zap.SugaredLogger,
 func (mc *MockStorageHandler) CreateObject(ctx context.Context, l *zap.SugaredLogger, db models.DBInterface, body io.Reader, application string, resourceUUID uuid.UUID, payload *models.ExportPayload) error {
 	fmt.Println("Ran mockStorageHandler.CreateObject")
 
+	if err := payload.SetStatusRunning(db); err != nil {
+		return err
+	}
+
 	_, err := io.ReadAll(body)
 	if err != nil {
 		return err
@@ -463,10 +763,45 @@ func (mc *MockStorageHandler) CreateObject(ctx context.Context, l *zap.SugaredLo
 	return nil
 }
 
-func (mc *MockStorageHandler) GetObject(ctx context.Context, l *zap.SugaredLogger, key string) (io.ReadCloser, error) {
+func (mc *MockStorageHandler) GetObject(ctx context.Context, l *zap.SugaredLogger, key, byteRange, ifMatch string) (io.ReadCloser, error) {
 	fmt.Println("Ran mockStorageHandler.GetObject")
 
-	return nil, nil
+	if ifMatch != "" && (mc.Replaced || ifMatch != MockObjectETag) {
+		return nil, ErrObjectChanged
+	}
+
+	body := MockObjectBody
+	if byteRange != "" {
+		var start, end int
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, err
+		}
+		body = body[start : end+1]
+	}
+	return io.NopCloser(strings.NewReader(body)), nil
+}
+
+func (mc *MockStorageHandler) HeadObject(ctx context.Context, l *zap.SugaredLogger, key string) (*ObjectInfo, error) {
+	fmt.Println("Ran mockStorageHandler.HeadObject")
+
+	return &ObjectInfo{
+		ContentLength: int64(len(MockObjectBody)),
+		ETag:          MockObjectETag,
+		LastModified:  MockObjectLastModified,
+	}, nil
+}
+
+func (mc *MockStorageHandler) PresignGetObject(ctx context.Context, l *zap.SugaredLogger, key, filename string, expires time.Duration) (string, error) {
+	fmt.Println("Ran mockStorageHandler.PresignGetObject")
+
+	return fmt.Sprintf("https://s3.example.com/%s?X-Amz-Expires=%d", key, int(expires.Seconds())), nil
+}
+
+func (mc *MockStorageHandler) DeleteObject(ctx context.Context, l *zap.SugaredLogger, key string) error {
+	fmt.Println("Ran mockStorageHandler.DeleteObject")
+
+	mc.DeletedKeys = append(mc.DeletedKeys, key)
+	return nil
 }
 
 func (mc *MockStorageHandler) ProcessSources(db models.DBInterface, uid uuid.UUID) {
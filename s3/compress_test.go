@@ -0,0 +1,264 @@
+package s3_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	azip "github.com/alexmullins/zip"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/s3"
+)
+
+// pagedBucket is a mocked ListObjectsV2 which returns the objects of the
+// bucket in pages of at most 1000 objects, like S3 does.
+type pagedBucket struct {
+	objects []types.Object
+	calls   int
+}
+
+func (b *pagedBucket) ListObjectsV2(ctx context.Context, params *awss3.ListObjectsV2Input, optFns ...func(*awss3.Options)) (*awss3.ListObjectsV2Output, error) {
+	b.calls++
+	start := 0
+	if params.ContinuationToken != nil {
+		start, _ = strconv.Atoi(*params.ContinuationToken)
+	}
+	end := min(start+1000, len(b.objects))
+
+	out := &awss3.ListObjectsV2Output{
+		Contents:    b.objects[start:end],
+		IsTruncated: aws.Bool(end < len(b.objects)),
+	}
+	if end < len(b.objects) {
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+var _ = Describe("Listing objects", func() {
+	It("lists every page of objects", func() {
+		bucket := &pagedBucket{}
+		for i := range 2500 {
+			bucket.objects = append(bucket.objects, types.Object{Key: aws.String(fmt.Sprintf("org/export/%d.json", i))})
+		}
+
+		objects, err := s3.ListObjects(context.Background(), bucket, "exports-bucket", "org/export/")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(objects).To(Equal(bucket.objects))
+		Expect(bucket.calls).To(Equal(3))
+	})
+
+	It("lists empty prefixes", func() {
+		objects, err := s3.ListObjects(context.Background(), &pagedBucket{}, "exports-bucket", "org/export/")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(objects).To(BeEmpty())
+	})
+})
+
+// fakeBucket is an S3 endpoint which keeps the objects that are uploaded to
+// it, in a single request or in parts.
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+}
+
+func newFakeBucket() *fakeBucket {
+	return &fakeBucket{objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	body, err := io.ReadAll(r.Body)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		b.parts[r.URL.Path] = make(map[int][]byte)
+		Expect(xml.NewEncoder(w).Encode(struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: r.URL.Path})).To(Succeed())
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		Expect(err).ShouldNot(HaveOccurred())
+		b.parts[r.URL.Path][number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts := b.parts[r.URL.Path]
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var object []byte
+		for _, number := range numbers {
+			object = append(object, parts[number]...)
+		}
+		b.objects[r.URL.Path] = object
+		delete(b.parts, r.URL.Path)
+		Expect(xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			ETag    string
+		}{ETag: `"object"`})).To(Succeed())
+	case r.Method == http.MethodPut:
+		b.objects[r.URL.Path] = body
+		w.Header().Set("ETag", `"object"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// object returns the object stored under key in the bucket.
+func (b *fakeBucket) object(bucket, key string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects["/"+bucket+"/"+key]
+}
+
+// watchHeap samples the heap in use until the returned function is called,
+// which returns the peak.
+func watchHeap() func() uint64 {
+	var peak uint64
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapInuse)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		<-stopped
+		return peak
+	}
+}
+
+var _ = Describe("Uploading archives", func() {
+	const (
+		size     = 5 << 30 // beyond the 4 GiB limit of zips without zip64
+		password = "s3cr3t"
+	)
+
+	var (
+		bucket     *fakeBucket
+		compressor *s3.Compressor
+		paths      []string
+		meta       s3.ExportMeta
+	)
+
+	BeforeEach(func() {
+		bucket = newFakeBucket()
+		server := httptest.NewServer(bucket)
+		DeferCleanup(server.Close)
+
+		cfg := *config.Get()
+		cfg.StorageConfig.Endpoint = server.URL
+		cfg.StorageConfig.Region = "us-east-1"
+		cfg.StorageConfig.Bucket = "exports-bucket"
+		cfg.ArchiveConfig.ZipLevel = flate.BestSpeed
+		cfg.ArchiveConfig.PasswordKey = bytes.Repeat([]byte{1}, 32)
+		log := zap.NewNop().Sugar()
+		compressor = &s3.Compressor{
+			Cfg: cfg,
+			Log: log,
+			// small parts, so that the archive is uploaded in several
+			TMClient: transfermanager.New(s3.NewS3Client(cfg, log), func(o *transfermanager.Options) {
+				o.PartSizeBytes = 5 << 20
+				o.MultipartUploadThreshold = 5 << 20
+			}),
+		}
+
+		// a sparse file of zeros, which takes no space on disk, and random
+		// data which does not compress
+		dir := GinkgoT().TempDir()
+		paths = []string{filepath.Join(dir, "zeros.json"), filepath.Join(dir, "random.json")}
+		f, err := os.Create(paths[0])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(f.Truncate(size)).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+		random := make([]byte, 16<<20)
+		_, err = rand.Read(random)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(os.WriteFile(paths[1], random, 0600)).To(Succeed())
+
+		meta = s3.ExportMeta{FileMeta: []s3.ExportFileMeta{{Filename: "zeros.json"}, {Filename: "random.json"}}}
+	})
+
+	It("streams zips with zip64 to S3", func() {
+		stop := watchHeap()
+		Expect(compressor.UploadArchive(context.Background(), paths, meta, models.Zip, models.Encryption{}, "org/export.zip")).To(Succeed())
+		Expect(stop()).To(BeNumerically("<", 256<<20))
+
+		object := bucket.object("exports-bucket", "org/export.zip")
+		Expect(len(object)).To(BeNumerically(">", 16<<20))
+		path := filepath.Join(GinkgoT().TempDir(), "export.zip")
+		Expect(os.WriteFile(path, object, 0600)).To(Succeed())
+
+		verified, err := s3.VerifyArchive(path, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(verified.FileMeta[0].Size).To(BeEquivalentTo(size))
+	})
+
+	It("streams zips encrypted with a password to S3", func() {
+		keys, err := s3.DeriveZipKeys(password, len(paths))
+		Expect(err).ShouldNot(HaveOccurred())
+		wrapped, err := s3.WrapZipKeys(compressor.Cfg.ArchiveConfig.PasswordKey, keys)
+		Expect(err).ShouldNot(HaveOccurred())
+		encryption := models.Encryption{Type: models.PasswordEncryption, Key: wrapped}
+
+		stop := watchHeap()
+		Expect(compressor.UploadArchive(context.Background(), paths, meta, models.Zip, encryption, "org/export.zip")).To(Succeed())
+		Expect(stop()).To(BeNumerically("<", 256<<20))
+
+		object := bucket.object("exports-bucket", "org/export.zip")
+		zr, err := azip.NewReader(bytes.NewReader(object), int64(len(object)))
+		Expect(err).ShouldNot(HaveOccurred())
+		sizes := make(map[string]int64)
+		for _, f := range zr.File {
+			Expect(f.IsEncrypted()).To(BeTrue())
+			f.SetPassword(password)
+			rc, err := f.Open()
+			Expect(err).ShouldNot(HaveOccurred())
+			sizes[f.Name], err = io.Copy(io.Discard, rc)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(rc.Close()).To(Succeed())
+		}
+		Expect(sizes).To(HaveKeyWithValue("zeros.json", BeEquivalentTo(size)))
+		Expect(sizes).To(HaveKeyWithValue("random.json", BeEquivalentTo(16<<20)))
+	})
+})
@@ -0,0 +1,568 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// table is the data of a source. Its rows are read from the source one at a
+// time, so that sources do not have to fit in memory. Values are decoded from
+// JSON, with numbers as json.Number, or are strings when read from CSV.
+type table struct {
+	// columns are in the order they first appear in the data
+	columns []string
+
+	r    io.ReadSeeker
+	from models.PayloadFormat
+}
+
+// convertFiles converts the downloaded files of the sources which were not
+// uploaded in format. The converted files replace the downloaded ones, which
+// are closed. PDFs are rendered with the details of meta.
+func convertFiles(log *zap.SugaredLogger, files []s3FileData, sources []models.Source, format models.PayloadFormat, meta ExportMeta, tempDir string) ([]s3FileData, error) {
+	for i, f := range files {
+		id := strings.Split(f.basename, ".")[0]
+
+		var source *models.Source
+		for j := range sources {
+			if sources[j].ID.String() == id {
+				source = &sources[j]
+			}
+		}
+		if source == nil || source.Format == "" || source.Format == format {
+			continue
+		}
+		from := source.Format
+
+		basename := fmt.Sprintf("%s.%s", id, format)
+		converted, err := os.CreateTemp(tempDir, basename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		if format == models.PDF {
+			var fileMeta *ExportFileMeta
+			if fileMeta, err = findFileMeta(id, basename, sources); err == nil {
+				err = RenderPDF(converted, f.file, from, meta, *fileMeta)
+			}
+		} else {
+			err = ConvertSource(converted, f.file, from, format)
+		}
+		if err != nil {
+			converted.Close()
+			return nil, fmt.Errorf("failed to convert %s from %s to %s: %w", f.basename, from, format, err)
+		}
+		if _, err := converted.Seek(0, io.SeekStart); err != nil {
+			converted.Close()
+			return nil, fmt.Errorf("failed to seek to beginning of file: %w", err)
+		}
+
+		log.Infof("converted %s from %s to %s", f.basename, from, format)
+		f.file.Close()
+		files[i] = s3FileData{converted, basename}
+	}
+	return files, nil
+}
+
+// ConvertSource converts the data of a source from the json or csv it was
+// uploaded in to format. PDFs are rendered with RenderPDF instead. The source
+// is read twice, first for its columns and then for its rows.
+func ConvertSource(w io.Writer, r io.ReadSeeker, from, format models.PayloadFormat) error {
+	t, err := readTable(r, from)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case models.CSV:
+		return writeCSVTable(w, t)
+	case models.JSON:
+		return writeJSONTable(w, t)
+	case models.NDJSON:
+		return writeNDJSONTable(w, t)
+	case models.XLSX:
+		return writeXLSXTable(w, t)
+	case models.Parquet:
+		return writeParquetTable(w, t)
+	default:
+		return fmt.Errorf("cannot convert to %s", format)
+	}
+}
+
+// readTable reads the columns of a source which was uploaded in json or csv.
+// Its rows are read afterwards with each.
+func readTable(r io.ReadSeeker, from models.PayloadFormat) (*table, error) {
+	if from != models.JSON && from != models.CSV {
+		return nil, fmt.Errorf("cannot convert from %s", from)
+	}
+
+	t := &table{r: r, from: from}
+	seen := make(map[string]bool)
+	addColumns := func(_ map[string]any, columns []string) error {
+		for _, column := range columns {
+			if !seen[column] {
+				seen[column] = true
+				t.columns = append(t.columns, column)
+			}
+		}
+		return nil
+	}
+
+	if from == models.JSON {
+		if err := t.scan(addColumns); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	// the columns of csv are its header, which sources without rows have too
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header, err := csv.NewReader(r).Read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return t, addColumns(nil, header)
+}
+
+// each calls fn with every row of the table, in order.
+func (t *table) each(fn func(row map[string]any) error) error {
+	return t.scan(func(row map[string]any, _ []string) error {
+		return fn(row)
+	})
+}
+
+// scan reads the source from its beginning, and calls fn with every row and
+// the columns of the row.
+func (t *table) scan(fn func(row map[string]any, columns []string) error) error {
+	if _, err := t.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if t.from == models.CSV {
+		return scanCSV(t.r, fn)
+	}
+	return scanJSON(t.r, fn)
+}
+
+// scanJSON reads a JSON array of objects, each of which is a row. Any other
+// value, or element of the array, is read as a row with a single `value`
+// column.
+func scanJSON(r io.Reader, fn func(row map[string]any, columns []string) error) error {
+	br := bufio.NewReader(r)
+	first, err := peekJSON(br)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(br)
+	if first != '[' {
+		return scanJSONElement(dec, fn)
+	}
+
+	if _, err := dec.Token(); err != nil { // the opening bracket
+		return err
+	}
+	for dec.More() {
+		if err := scanJSONElement(dec, fn); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // the closing bracket
+	return err
+}
+
+// scanJSONElement decodes the next value of dec as a row, and calls fn with
+// it.
+func scanJSONElement(dec *json.Decoder, fn func(row map[string]any, columns []string) error) error {
+	var element json.RawMessage
+	if err := dec.Decode(&element); err != nil {
+		return err
+	}
+	row, columns, err := decodeJSONRow(element)
+	if err != nil {
+		return err
+	}
+	return fn(row, columns)
+}
+
+// peekJSON returns the first byte of the JSON value read by br, without
+// reading it.
+func peekJSON(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// decodeJSONRow decodes a row, and returns its columns in their order in the
+// JSON object.
+func decodeJSONRow(data json.RawMessage) (map[string]any, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if !bytes.HasPrefix(data, []byte("{")) {
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{"value": value}, []string{"value"}, nil
+	}
+
+	if _, err := dec.Token(); err != nil { // the opening brace
+		return nil, nil, err
+	}
+	row := make(map[string]any)
+	var columns []string
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		column := token.(string)
+
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := row[column]; !ok {
+			columns = append(columns, column)
+		}
+		row[column] = value
+	}
+	return row, columns, nil
+}
+
+// scanCSV reads CSV with a header row. Rows may have fewer values than the
+// header, the missing ones are null. Of columns with the same name, the last
+// one is kept.
+func scanCSV(r io.Reader, fn func(row map[string]any, columns []string) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		row := make(map[string]any, len(header))
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = value
+			}
+		}
+		if err := fn(row, header); err != nil {
+			return err
+		}
+	}
+}
+
+// cellString returns value as the text of a CSV cell. Arrays and objects are
+// written as JSON.
+func cellString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func writeCSVTable(w io.Writer, t *table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.columns); err != nil {
+		return err
+	}
+	err := t.each(func(row map[string]any) error {
+		record := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			record[i] = cellString(row[column])
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// marshalRow marshals row into a JSON object with the columns of the table in
+// their order. Columns which the row does not have are left out.
+func marshalRow(t *table, row map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, column := range t.columns {
+		value, ok := row[column]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeJSONTable(w io.Writer, t *table) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	err := t.each(func(row map[string]any) error {
+		b, err := marshalRow(t, row)
+		if err != nil {
+			return err
+		}
+		if !first {
+			b = append([]byte(","), b...)
+		}
+		first = false
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+func writeNDJSONTable(w io.Writer, t *table) error {
+	return t.each(func(row map[string]any) error {
+		b, err := marshalRow(t, row)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// xlsxSheetRows is the number of rows of a sheet, including its header.
+var xlsxSheetRows = excelize.TotalRows
+
+// writeXLSXTable writes the table to the first sheet of a workbook, with the
+// columns in the first row. JSON numbers are written as numbers. Rows which do
+// not fit the first sheet are written to further sheets, each with the columns
+// in their first row.
+func writeXLSXTable(w io.Writer, t *table) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	header := make([]any, len(t.columns))
+	for i, column := range t.columns {
+		header[i] = column
+	}
+
+	var sw *excelize.StreamWriter
+	sheets, i := 0, 0
+	// newSheet flushes the current sheet and starts the next one
+	newSheet := func() error {
+		if sw != nil {
+			if err := sw.Flush(); err != nil {
+				return err
+			}
+		}
+
+		sheets++
+		sheet := f.GetSheetName(0)
+		if sheets > 1 {
+			sheet = fmt.Sprintf("Sheet%d", sheets)
+			if _, err := f.NewSheet(sheet); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		sw, err = f.NewStreamWriter(sheet)
+		if err != nil {
+			return err
+		}
+		i = 0
+		return sw.SetRow("A1", header)
+	}
+	if err := newSheet(); err != nil {
+		return err
+	}
+
+	err := t.each(func(row map[string]any) error {
+		values := make([]any, len(t.columns))
+		for j, column := range t.columns {
+			switch v := row[column].(type) {
+			case nil, string, bool:
+				values[j] = v
+			case json.Number:
+				if n, err := v.Float64(); err == nil {
+					values[j] = n
+				} else {
+					values[j] = v.String()
+				}
+			default:
+				values[j] = cellString(v)
+			}
+		}
+		if i+1 == xlsxSheetRows {
+			if err := newSheet(); err != nil {
+				return err
+			}
+		}
+		i++
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		return sw.SetRow(cell, values)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// parquetRowGroupSize is the number of rows of a parquet row group, which
+// are buffered before they are written.
+const parquetRowGroupSize = 64 * 1024
+
+// writeParquetTable writes the table to parquet. Columns whose values are all
+// integers, numbers or booleans keep their type, all other columns are
+// strings. Every column is optional, and the columns are ordered by their
+// names, as in any parquet group.
+func writeParquetTable(w io.Writer, t *table) error {
+	group := make(parquet.Group, len(t.columns))
+	for _, name := range t.columns {
+		group[name] = parquet.String()
+	}
+
+	// the types of the columns are only known once every row was read
+	ints, numbers, bools := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, name := range t.columns {
+		ints[name], numbers[name], bools[name] = true, true, true
+	}
+	err := t.each(func(row map[string]any) error {
+		for name, value := range row {
+			switch v := value.(type) {
+			case nil:
+			case json.Number:
+				bools[name] = false
+				if _, err := v.Int64(); err != nil {
+					ints[name] = false
+				}
+				if _, err := v.Float64(); err != nil {
+					numbers[name] = false
+				}
+			case bool:
+				ints[name], numbers[name] = false, false
+			default:
+				ints[name], numbers[name], bools[name] = false, false, false
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range t.columns {
+		switch {
+		case bools[name] && (ints[name] || numbers[name]):
+			// every value is null
+		case ints[name]:
+			group[name] = parquet.Int(64)
+		case numbers[name]:
+			group[name] = parquet.Leaf(parquet.DoubleType)
+		case bools[name]:
+			group[name] = parquet.Leaf(parquet.BooleanType)
+		}
+		group[name] = parquet.Optional(group[name])
+	}
+	schema := parquet.NewSchema("schema", group)
+
+	writer := parquet.NewWriter(w, schema,
+		parquet.CreatedBy("export-service", "", ""),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+	)
+	fields := schema.Fields()
+	err = t.each(func(row map[string]any) error {
+		values := make(parquet.Row, len(fields))
+		for i, field := range fields {
+			value := row[field.Name()]
+			if value == nil {
+				values[i] = parquet.NullValue().Level(0, 0, i)
+				continue
+			}
+			switch field.Type().Kind() {
+			case parquet.Int64:
+				n, _ := value.(json.Number).Int64()
+				values[i] = parquet.Int64Value(n)
+			case parquet.Double:
+				n, _ := value.(json.Number).Float64()
+				values[i] = parquet.DoubleValue(n)
+			case parquet.Boolean:
+				values[i] = parquet.BooleanValue(value.(bool))
+			default:
+				values[i] = parquet.ByteArrayValue([]byte(cellString(value)))
+			}
+			values[i] = values[i].Level(0, 1, i)
+		}
+		_, err := writer.WriteRows([]parquet.Row{values})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,190 @@
+package s3_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/parquet-go/parquet-go"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/s3"
+)
+
+var _ = Describe("Converting sources", func() {
+	const jsonSource = `[{"id": 1, "name": "host-a", "tags": ["a", "b"]}, {"id": 2.5, "name": null, "stale": true}]`
+
+	convert := func(data string, from, to models.PayloadFormat) []byte {
+		var buf bytes.Buffer
+		Expect(s3.ConvertSource(&buf, strings.NewReader(data), from, to)).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("converts json to csv with the columns in their order", func() {
+		Expect(string(convert(jsonSource, models.JSON, models.CSV))).To(Equal(
+			"id,name,tags,stale\n" +
+				"1,host-a,\"[\"\"a\"\",\"\"b\"\"]\",\n" +
+				"2.5,,,true\n",
+		))
+	})
+
+	It("converts json to ndjson", func() {
+		Expect(string(convert(jsonSource, models.JSON, models.NDJSON))).To(Equal(
+			`{"id":1,"name":"host-a","tags":["a","b"]}` + "\n" +
+				`{"id":2.5,"name":null,"stale":true}` + "\n",
+		))
+	})
+
+	It("converts csv to json", func() {
+		Expect(convert("id,name\n1,host-a\n2\n", models.CSV, models.JSON)).To(MatchJSON(
+			`[{"id": "1", "name": "host-a"}, {"id": "2"}]`,
+		))
+	})
+
+	It("converts json to xlsx", func() {
+		f, err := excelize.OpenReader(bytes.NewReader(convert(jsonSource, models.JSON, models.XLSX)))
+		Expect(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		rows, err := f.GetRows(f.GetSheetName(0))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(rows).To(Equal([][]string{
+			{"id", "name", "tags", "stale"},
+			{"1", "host-a", `["a","b"]`},
+			{"2.5", "", "", "TRUE"},
+		}))
+	})
+
+	It("continues xlsx on further sheets once a sheet is full", func() {
+		DeferCleanup(s3.SetXLSXSheetRows(3))
+
+		source := `[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}]`
+		f, err := excelize.OpenReader(bytes.NewReader(convert(source, models.JSON, models.XLSX)))
+		Expect(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		Expect(f.GetSheetList()).To(Equal([]string{"Sheet1", "Sheet2", "Sheet3"}))
+		var sheets [][][]string
+		for _, sheet := range f.GetSheetList() {
+			rows, err := f.GetRows(sheet)
+			Expect(err).ShouldNot(HaveOccurred())
+			sheets = append(sheets, rows)
+		}
+		Expect(sheets).To(Equal([][][]string{
+			{{"id"}, {"1"}, {"2"}},
+			{{"id"}, {"3"}, {"4"}},
+			{{"id"}, {"5"}},
+		}))
+	})
+
+	It("converts json to parquet", func() {
+		type host struct {
+			ID    *float64 `parquet:"id,optional"`
+			Name  *string  `parquet:"name,optional"`
+			Tags  *string  `parquet:"tags,optional"`
+			Stale *bool    `parquet:"stale,optional"`
+		}
+		id, name, tags := 1.0, "host-a", `["a","b"]`
+		id2, stale := 2.5, true
+
+		reader := parquet.NewGenericReader[host](bytes.NewReader(convert(jsonSource, models.JSON, models.Parquet)))
+		defer reader.Close()
+
+		rows := make([]host, 3)
+		n, err := reader.Read(rows)
+		Expect(err).To(Equal(io.EOF))
+		Expect(rows[:n]).To(Equal([]host{
+			{ID: &id, Name: &name, Tags: &tags},
+			{ID: &id2, Stale: &stale},
+		}))
+	})
+
+	It("keeps the type of parquet columns", func() {
+		data := convert(`[{"count": 1, "ratio": 0.5, "ok": true, "name": "a", "empty": null}]`, models.JSON, models.Parquet)
+
+		f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		kinds := make(map[string]parquet.Kind)
+		for _, field := range f.Schema().Fields() {
+			Expect(field.Optional()).To(BeTrue())
+			kinds[field.Name()] = field.Type().Kind()
+		}
+		Expect(kinds).To(Equal(map[string]parquet.Kind{
+			"count": parquet.Int64,
+			"ratio": parquet.Double,
+			"ok":    parquet.Boolean,
+			"name":  parquet.ByteArray,
+			"empty": parquet.ByteArray,
+		}))
+	})
+
+	It("writes large sources to parquet in several row groups", func() {
+		var source strings.Builder
+		source.WriteString("id\n")
+		for i := 0; i < 100000; i++ {
+			fmt.Fprintf(&source, "%d\n", i)
+		}
+		data := convert(source.String(), models.CSV, models.Parquet)
+
+		f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(f.NumRows()).To(BeEquivalentTo(100000))
+		Expect(len(f.RowGroups())).To(BeNumerically(">", 1))
+	})
+
+	It("rejects data it cannot convert", func() {
+		var buf bytes.Buffer
+		Expect(s3.ConvertSource(&buf, strings.NewReader("{"), models.JSON, models.CSV)).ToNot(Succeed())
+		Expect(s3.ConvertSource(&buf, strings.NewReader("{}"), models.XLSX, models.CSV)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Rendering PDFs", func() {
+	meta := s3.ExportMeta{ExportBy: "user", ExportDate: "2024-01-01T00:00:00Z", ExportOrgID: "10000001"}
+	file := s3.ExportFileMeta{Application: "exampleApp", Resource: "exampleResource", Filters: map[string]interface{}{"status": "active"}}
+
+	render := func(data string, from models.PayloadFormat) []byte {
+		var buf bytes.Buffer
+		Expect(s3.RenderPDF(&buf, strings.NewReader(data), from, meta, file)).To(Succeed())
+		return buf.Bytes()
+	}
+	pages := func(pdf []byte) int {
+		return len(regexp.MustCompile(`/Type /Page\b`).FindAll(pdf, -1))
+	}
+
+	It("renders the rows of a source as a table", func() {
+		pdf := render(`[{"id": 1, "name": "host-a"}, {"id": 2, "name": "host-b"}]`, models.JSON)
+
+		Expect(pdf).To(HavePrefix("%PDF-"))
+		Expect(pages(pdf)).To(Equal(1))
+	})
+
+	It("paginates large sources", func() {
+		var csv strings.Builder
+		csv.WriteString("id,name\n")
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(&csv, "%d,host-%d\n", i, i)
+		}
+
+		Expect(pages(render(csv.String(), models.CSV))).To(BeNumerically(">", 1))
+	})
+
+	It("renders text which is not in cp1252", func() {
+		pdf := render(`[{"name": "Größe", "city": "Київ", "note": "Ελλάδα €"}]`, models.JSON)
+
+		Expect(pdf).To(HavePrefix("%PDF-"))
+		Expect(pages(pdf)).To(Equal(1))
+		// the text is embedded with a TrueType font
+		Expect(string(pdf)).To(ContainSubstring("/FontFile2"))
+	})
+
+	It("renders sources without data", func() {
+		Expect(render(`[]`, models.JSON)).To(HavePrefix("%PDF-"))
+	})
+})
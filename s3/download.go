@@ -2,10 +2,19 @@ package s3
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
+// ObjectInfo holds the metadata of a stored object that is needed to serve it
+// over HTTP.
+type ObjectInfo struct {
+	ContentLength int64
+	ETag          string
+	LastModified  time.Time
+}
+
 // S3GetObjectAPI defines the interface for the GetObject function.
 // We use this interface to test the function using a mocked service.
 type S3GetObjectAPI interface {
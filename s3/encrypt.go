@@ -0,0 +1,355 @@
+package s3
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// VerifyEncryption verifies that the archive of an export can be encrypted
+// with the key of encryption, and in the archive format.
+func VerifyEncryption(encryption models.Encryption, archive models.ArchiveFormat) error {
+	switch encryption.Type {
+	case "":
+		return nil
+	case models.AgeEncryption:
+		if _, err := age.ParseX25519Recipient(strings.TrimSpace(encryption.Key)); err != nil {
+			return fmt.Errorf("invalid age public key: %w", err)
+		}
+	case models.PGPEncryption:
+		if _, err := pgpRecipients(encryption.Key); err != nil {
+			return err
+		}
+	case models.PasswordEncryption:
+		if encryption.Key == "" {
+			return fmt.Errorf("password encryption requires a password")
+		}
+		if archive != models.Zip && archive != "" {
+			return fmt.Errorf("password encryption is only supported for zip archives")
+		}
+	default:
+		return fmt.Errorf("invalid encryption type '%s'", encryption.Type)
+	}
+	return nil
+}
+
+// pgpRecipients reads the armored OpenPGP public keys of the recipients, each
+// of which has to have a key which can be encrypted to.
+func pgpRecipients(key string) (openpgp.EntityList, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP public key: %w", err)
+	}
+	for _, entity := range entities {
+		if _, ok := entity.EncryptionKey(time.Now()); !ok {
+			return nil, fmt.Errorf("OpenPGP public key %X can not be used for encryption", entity.PrimaryKey.Fingerprint)
+		}
+	}
+	return entities, nil
+}
+
+// NewEncryptionWriter returns a writer which encrypts the archive written to
+// it to the age or OpenPGP public key of encryption, and writes it to w. It
+// has to be closed once the archive is written. Password encrypted archives
+// are written by NewPasswordZipWriter instead.
+func NewEncryptionWriter(w io.Writer, encryption models.Encryption) (io.WriteCloser, error) {
+	switch encryption.Type {
+	case models.AgeEncryption:
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(encryption.Key))
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(w, recipient)
+	case models.PGPEncryption:
+		recipients, err := pgpRecipients(encryption.Key)
+		if err != nil {
+			return nil, err
+		}
+		return openpgp.Encrypt(w, recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	default:
+		return nil, fmt.Errorf("cannot encrypt archives with %s", encryption.Type)
+	}
+}
+
+// zipMetadataFiles is the number of metadata files which are added to a zip
+// after the files of its sources, see addMetadataFilesToArchive.
+const zipMetadataFiles = 4
+
+// The WinZip AES encryption of zip files, with 256 bit keys. The keys of each
+// file are derived from the password with its own salt.
+const (
+	winZipAESMethod     = 99
+	winZipAESExtraID    = 0x9901
+	winZipAESStrength   = 3
+	winZipSaltSize      = 16
+	winZipKeySize       = 32
+	winZipVerifierSize  = 2
+	winZipAuthCodeSize  = 10
+	winZipKeyIterations = 1000
+)
+
+// zipKey is what a file of a zip is encrypted with: its salt, and the keys and
+// password verifier derived from the password with it.
+type zipKey struct {
+	salt     []byte
+	encKey   []byte
+	authKey  []byte
+	verifier []byte
+}
+
+const zipKeySize = winZipSaltSize + 2*winZipKeySize + winZipVerifierSize
+
+// ZipKeys are the keys of the files of a password encrypted zip. They are
+// derived from the password when the export is requested, so that only they
+// have to be kept until the archive is written, and the password is not.
+type ZipKeys []zipKey
+
+// DeriveZipKeys derives the keys of a zip with the files of the given number
+// of sources and its metadata files from password, each with a random salt.
+func DeriveZipKeys(password string, sources int) (ZipKeys, error) {
+	keys := make(ZipKeys, sources+zipMetadataFiles)
+	for i := range keys {
+		salt := make([]byte, winZipSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		derived, err := pbkdf2.Key(sha1.New, password, salt, winZipKeyIterations, 2*winZipKeySize+winZipVerifierSize)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = zipKey{
+			salt:     salt,
+			encKey:   derived[:winZipKeySize],
+			authKey:  derived[winZipKeySize : 2*winZipKeySize],
+			verifier: derived[2*winZipKeySize:],
+		}
+	}
+	return keys, nil
+}
+
+// WrapZipKeys encrypts the keys of a zip with the AES-256 key, so that they
+// are not stored in the clear until the archive is written. The nonce is
+// prepended to the sealed keys, which are base64 encoded.
+func WrapZipKeys(key []byte, keys ZipKeys) (string, error) {
+	aead, err := passwordAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	plain := make([]byte, 0, len(keys)*zipKeySize)
+	for _, k := range keys {
+		plain = append(append(append(append(plain, k.salt...), k.encKey...), k.authKey...), k.verifier...)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// UnwrapZipKeys decrypts the keys of a zip wrapped by WrapZipKeys with the
+// same key.
+func UnwrapZipKeys(key []byte, wrapped string) (ZipKeys, error) {
+	aead, err := passwordAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("the keys of the archive are not wrapped")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap the keys of the archive: %w", err)
+	}
+	if len(plain) == 0 || len(plain)%zipKeySize != 0 {
+		return nil, fmt.Errorf("the keys of the archive are invalid")
+	}
+
+	keys := make(ZipKeys, 0, len(plain)/zipKeySize)
+	for ; len(plain) > 0; plain = plain[zipKeySize:] {
+		keys = append(keys, zipKey{
+			salt:     plain[:winZipSaltSize],
+			encKey:   plain[winZipSaltSize : winZipSaltSize+winZipKeySize],
+			authKey:  plain[winZipSaltSize+winZipKeySize : winZipSaltSize+2*winZipKeySize],
+			verifier: plain[winZipSaltSize+2*winZipKeySize : zipKeySize],
+		})
+	}
+	return keys, nil
+}
+
+func passwordAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("password encryption is not enabled")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewPasswordZipWriter returns an ArchiveWriter which writes a zip whose
+// files are encrypted with AES-256 (AE-1), each with the next of keys. The
+// files are compressed at the default level.
+func NewPasswordZipWriter(w io.Writer, keys ZipKeys) ArchiveWriter {
+	return &passwordZipArchiveWriter{zw: zip.NewWriter(w), keys: keys}
+}
+
+type passwordZipArchiveWriter struct {
+	zw   *zip.Writer
+	keys ZipKeys
+}
+
+func (a *passwordZipArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	if len(a.keys) == 0 {
+		return nil, fmt.Errorf("no key is left for %s, the archive has more files than its keys were derived for", name)
+	}
+	key := a.keys[0]
+	a.keys = a.keys[1:]
+
+	// the file is deflated and then encrypted, with the keys of this file
+	a.zw.RegisterCompressor(winZipAESMethod, func(w io.Writer) (io.WriteCloser, error) {
+		return newWinZipAESWriter(w, key)
+	})
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], winZipAESExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 1) // AE-1, which keeps the CRC
+	copy(extra[6:], "AE")
+	extra[8] = winZipAESStrength
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   winZipAESMethod,
+		Flags:    0x1, // encrypted
+		Extra:    extra,
+		Modified: modTime,
+	}
+	header.SetMode(0644)
+	return a.zw.CreateHeader(header)
+}
+
+func (a *passwordZipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// winZipAESWriter deflates a file, and encrypts it with AES in the counter
+// mode of WinZip, whose counter is little endian and starts at 1. The salt and
+// password verifier precede the encrypted file, and the HMAC-SHA1 of the
+// encrypted file follows it.
+type winZipAESWriter struct {
+	w       io.Writer
+	key     zipKey
+	started bool
+	deflate *flate.Writer
+	block   cipher.Block
+	mac     hash.Hash
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipAESWriter(w io.Writer, key zipKey) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key.encKey)
+	if err != nil {
+		return nil, err
+	}
+	ew := &winZipAESWriter{w: w, key: key, block: block, mac: hmac.New(sha1.New, key.authKey), used: aes.BlockSize}
+	ew.deflate, err = flate.NewWriter(encryptedWriter{ew}, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+func (ew *winZipAESWriter) Write(p []byte) (int, error) {
+	return ew.deflate.Write(p)
+}
+
+func (ew *winZipAESWriter) Close() error {
+	if err := ew.deflate.Close(); err != nil {
+		return err
+	}
+	if err := ew.start(); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(ew.mac.Sum(nil)[:winZipAuthCodeSize])
+	return err
+}
+
+// start writes the salt and password verifier. They are only written with
+// the file, as the compressor is created before the header of the file is
+// written.
+func (ew *winZipAESWriter) start() error {
+	if ew.started {
+		return nil
+	}
+	ew.started = true
+	_, err := ew.w.Write(append(append([]byte{}, ew.key.salt...), ew.key.verifier...))
+	return err
+}
+
+// encrypt encrypts the deflated p and writes it.
+func (ew *winZipAESWriter) encrypt(p []byte) (int, error) {
+	if err := ew.start(); err != nil {
+		return 0, err
+	}
+	out := make([]byte, len(p))
+	for i := range p {
+		if ew.used == aes.BlockSize {
+			for j := range ew.counter {
+				ew.counter[j]++
+				if ew.counter[j] != 0 {
+					break
+				}
+			}
+			ew.block.Encrypt(ew.stream[:], ew.counter[:])
+			ew.used = 0
+		}
+		out[i] = p[i] ^ ew.stream[ew.used]
+		ew.used++
+	}
+	ew.mac.Write(out)
+	return ew.w.Write(out)
+}
+
+// encryptedWriter is what the deflated file is written to.
+type encryptedWriter struct {
+	ew *winZipAESWriter
+}
+
+func (e encryptedWriter) Write(p []byte) (int, error) {
+	return e.ew.encrypt(p)
+}
+
+// encryptionExtension returns the extension that is appended to the filename
+// of archives encrypted with encryption.
+func encryptionExtension(encryption models.EncryptionType) string {
+	switch encryption {
+	case models.AgeEncryption:
+		return ".age"
+	case models.PGPEncryption:
+		return ".gpg"
+	default:
+		return ""
+	}
+}
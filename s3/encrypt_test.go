@@ -0,0 +1,142 @@
+package s3_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	azip "github.com/alexmullins/zip"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/s3"
+)
+
+var _ = Describe("Encrypting archives", func() {
+	const archive = "the archive of an export"
+
+	encrypt := func(encryption models.Encryption) []byte {
+		var buf bytes.Buffer
+		w, err := s3.NewEncryptionWriter(&buf, encryption)
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = io.WriteString(w, archive)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+		Expect(buf.String()).ToNot(ContainSubstring(archive))
+		return buf.Bytes()
+	}
+
+	It("encrypts archives to an age public key", func() {
+		identity, err := age.GenerateX25519Identity()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		r, err := age.Decrypt(bytes.NewReader(encrypt(models.Encryption{Type: models.AgeEncryption, Key: identity.Recipient().String()})), identity)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(io.ReadAll(r)).To(BeEquivalentTo(archive))
+	})
+
+	It("encrypts archives to an OpenPGP public key", func() {
+		entity, err := openpgp.NewEntity("Export", "", "export@example.com", nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var publicKey bytes.Buffer
+		w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(entity.Serialize(w)).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		md, err := openpgp.ReadMessage(bytes.NewReader(encrypt(models.Encryption{Type: models.PGPEncryption, Key: publicKey.String()})), openpgp.EntityList{entity}, nil, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(io.ReadAll(md.UnverifiedBody)).To(BeEquivalentTo(archive))
+	})
+
+	It("writes zips encrypted with a password", func() {
+		keys, err := s3.DeriveZipKeys("s3cr3t", 1)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var buf bytes.Buffer
+		zw := s3.NewPasswordZipWriter(&buf, keys)
+		for _, name := range []string{"data.json", "README.md"} {
+			w, err := zw.Create(name, int64(len(archive)), time.Now())
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = io.WriteString(w, archive)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(zw.Close()).To(Succeed())
+
+		zr, err := azip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(zr.File).To(HaveLen(2))
+		for _, f := range zr.File {
+			Expect(f.IsEncrypted()).To(BeTrue())
+
+			f.SetPassword("s3cr3t")
+			rc, err := f.Open()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(io.ReadAll(rc)).To(BeEquivalentTo(archive))
+			Expect(rc.Close()).To(Succeed())
+		}
+
+		// the files are encrypted with keys of their own
+		Expect(zipSalt(buf.Bytes(), zr.File[0])).ToNot(Equal(zipSalt(buf.Bytes(), zr.File[1])))
+
+		zr.File[1].SetPassword("wrong")
+		_, err = zr.File[1].Open()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("only writes as many files as keys were derived for", func() {
+		keys, err := s3.DeriveZipKeys("s3cr3t", 0)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(keys).To(HaveLen(4))
+
+		zw := s3.NewPasswordZipWriter(io.Discard, keys)
+		for i := range keys {
+			_, err := zw.Create(fmt.Sprintf("%d.json", i), 0, time.Now())
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		_, err = zw.Create("extra.json", 0, time.Now())
+		Expect(err).To(MatchError(ContainSubstring("the archive has more files than its keys were derived for")))
+	})
+
+	It("wraps the keys derived from passwords with the password key", func() {
+		key := bytes.Repeat([]byte{7}, 32)
+		keys, err := s3.DeriveZipKeys("s3cr3t", 1)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		wrapped, err := s3.WrapZipKeys(key, keys)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(s3.UnwrapZipKeys(key, wrapped)).To(Equal(keys))
+
+		// every wrapping has its own nonce
+		Expect(s3.WrapZipKeys(key, keys)).ToNot(Equal(wrapped))
+
+		_, err = s3.UnwrapZipKeys(bytes.Repeat([]byte{8}, 32), wrapped)
+		Expect(err).To(MatchError(ContainSubstring("failed to unwrap")))
+		_, err = s3.WrapZipKeys(nil, keys)
+		Expect(err).To(MatchError("password encryption is not enabled"))
+	})
+
+	DescribeTable("rejects encryption which can not be used", func(encryption models.Encryption, archive models.ArchiveFormat, expectedError string) {
+		Expect(s3.VerifyEncryption(encryption, archive)).To(MatchError(ContainSubstring(expectedError)))
+	},
+		Entry("with an invalid age key", models.Encryption{Type: models.AgeEncryption, Key: "age1invalid"}, models.Zip, "invalid age public key"),
+		Entry("with an invalid OpenPGP key", models.Encryption{Type: models.PGPEncryption, Key: "not a key"}, models.Zip, "invalid OpenPGP public key"),
+		Entry("without a password", models.Encryption{Type: models.PasswordEncryption}, models.Zip, "requires a password"),
+		Entry("with a password for a tarball", models.Encryption{Type: models.PasswordEncryption, Key: "s3cr3t"}, models.TarGz, "only supported for zip archives"),
+		Entry("with an unknown type", models.Encryption{Type: "rot13"}, models.Zip, "invalid encryption type 'rot13'"),
+	)
+})
+
+// zipSalt returns the salt which precedes the encrypted data of a file of a
+// zip encrypted with a password.
+func zipSalt(archive []byte, f *azip.File) []byte {
+	offset, err := f.DataOffset()
+	Expect(err).ShouldNot(HaveOccurred())
+	return archive[offset : offset+16]
+}
@@ -0,0 +1,33 @@
+package s3
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// UploadArchive archives the files at paths with the metadata of the export,
+// as Compress does with the files of its sources, and uploads the archive
+// under s3key.
+func (c *Compressor) UploadArchive(ctx context.Context, paths []string, meta ExportMeta, archive models.ArchiveFormat, encryption models.Encryption, s3key string) error {
+	files := make([]s3FileData, 0, len(paths))
+	defer func() { closeFiles(c.Log, files) }()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, s3FileData{f, filepath.Base(path)})
+	}
+	return c.uploadArchive(ctx, c.Log, files, meta, archive, encryption, s3key)
+}
+
+// SetXLSXSheetRows sets the number of rows of an xlsx sheet until the returned
+// function is called.
+func SetXLSXSheetRows(rows int) (restore func()) {
+	previous := xlsxSheetRows
+	xlsxSheetRows = rows
+	return func() { xlsxSheetRows = previous }
+}
@@ -25,10 +25,19 @@ var uploadSizes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 	},
 }, []string{"app"})
 
+var compressionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "export_service_compression_seconds",
+	Help: "Number of seconds spent downloading the sources of an export and uploading its archive",
+	Buckets: []float64{
+		1, 5, 15, 30, 60, 120, 300, 600, 1800,
+	},
+}, []string{"archive"})
+
 func init() {
 	prometheus.MustRegister(totalUploads)
 	prometheus.MustRegister(failUploads)
 	prometheus.MustRegister(uploadSizes)
+	prometheus.MustRegister(compressionDuration)
 	// Set an initial value of 0 for the histogram so that it shows up in the metrics
 	uploadSizes.With(prometheus.Labels{"app": "testApp"})
 }
@@ -0,0 +1,205 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/signintech/gopdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+const (
+	pdfFont      = "go"
+	pdfRowHeight = 5.0
+	pdfMargin    = 10.0
+	// pdfBottomMargin leaves room for the page numbers
+	pdfBottomMargin = 15.0
+	// pdfMaxCellLength is how much of a value is considered when it is
+	// shortened to fit its cell.
+	pdfMaxCellLength = 200
+)
+
+// RenderPDF renders the json or csv data of a source as a table in a PDF,
+// after the details of the export and of the source. The header of the table
+// is repeated on every page.
+//
+// Text is written as UTF-8 with the embedded Go fonts, which cover the Latin,
+// Greek and Cyrillic scripts. Characters the fonts do not have, such as CJK,
+// are rendered as spaces.
+func RenderPDF(w io.Writer, r io.ReadSeeker, from models.PayloadFormat, meta ExportMeta, file ExportFileMeta) error {
+	t, err := readTable(r, from)
+	if err != nil {
+		return err
+	}
+
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{Unit: gopdf.UnitMM, PageSize: *gopdf.PageSizeA4Landscape})
+	if err := pdf.AddTTFFontDataWithOption(pdfFont, goregular.TTF, gopdf.TtfOption{Style: gopdf.Regular}); err != nil {
+		return err
+	}
+	if err := pdf.AddTTFFontDataWithOption(pdfFont, gobold.TTF, gopdf.TtfOption{Style: gopdf.Bold}); err != nil {
+		return err
+	}
+	pdf.SetInfo(gopdf.PdfInfo{Title: fmt.Sprintf("%s %s", file.Application, file.Resource), Producer: "export-service"})
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin, pdfBottomMargin)
+	pdf.SetTextColor(0, 0, 0)
+
+	pageWidth, pageHeight := pdf.PointsToUnits(gopdf.PageSizeA4Landscape.W), pdf.PointsToUnits(gopdf.PageSizeA4Landscape.H)
+	tableWidth := pageWidth - 2*pdfMargin
+
+	// cell writes text into a cell of the given width at the current
+	// position, and moves to the right of it
+	cell := func(width, height float64, text string, border int) error {
+		return pdf.CellWithOption(&gopdf.Rect{W: width, H: height}, text, gopdf.CellOption{
+			Align:  gopdf.Left | gopdf.Middle,
+			Border: border,
+			Float:  gopdf.Right,
+		})
+	}
+
+	pdf.AddPage()
+	if err := pdf.SetFont(pdfFont, "B", 14); err != nil {
+		return err
+	}
+	if err := cell(tableWidth, 8, fmt.Sprintf("%s: %s", file.Application, file.Resource), 0); err != nil {
+		return err
+	}
+	pdf.Br(8)
+
+	filters := "none"
+	if len(file.Filters) > 0 {
+		b, err := json.Marshal(file.Filters)
+		if err != nil {
+			return err
+		}
+		filters = string(b)
+	}
+	details := []struct{ label, value string }{
+		{"Exported by", meta.ExportBy},
+		{"Organization", meta.ExportOrgID},
+		{"Export date", meta.ExportDate},
+		{"Filters", filters},
+	}
+	for _, detail := range details {
+		if err := pdf.SetFont(pdfFont, "B", 9); err != nil {
+			return err
+		}
+		if err := cell(30, pdfRowHeight, detail.label, 0); err != nil {
+			return err
+		}
+		if err := pdf.SetFont(pdfFont, "", 9); err != nil {
+			return err
+		}
+		lines, err := pdf.SplitText(detail.value, tableWidth-30)
+		if err != nil {
+			// values without text cannot be split
+			lines = []string{detail.value}
+		}
+		for i, line := range lines {
+			if i > 0 {
+				pdf.SetX(pdfMargin + 30)
+			}
+			if err := cell(tableWidth-30, pdfRowHeight, line, 0); err != nil {
+				return err
+			}
+			pdf.Br(pdfRowHeight)
+		}
+	}
+	pdf.Br(pdfRowHeight)
+
+	if len(t.columns) == 0 {
+		if err := cell(tableWidth, pdfRowHeight, "The resource contains no data.", 0); err != nil {
+			return err
+		}
+		return writePDF(w, pdf)
+	}
+
+	width := tableWidth / float64(len(t.columns))
+
+	// fit shortens value to the width of a cell
+	fit := func(value string) string {
+		value = strings.Join(strings.Fields(value), " ")
+		runes := []rune(value)
+		if len(runes) > pdfMaxCellLength {
+			runes = runes[:pdfMaxCellLength]
+		}
+		if textWidth, err := pdf.MeasureTextWidth(string(runes)); err == nil && textWidth <= width-2 {
+			return string(runes)
+		}
+		for len(runes) > 0 {
+			if textWidth, err := pdf.MeasureTextWidth(string(runes) + "..."); err == nil && textWidth <= width-2 {
+				break
+			}
+			runes = runes[:len(runes)-1]
+		}
+		return string(runes) + "..."
+	}
+
+	header := func() error {
+		if err := pdf.SetFont(pdfFont, "B", 8); err != nil {
+			return err
+		}
+		pdf.SetFillColor(220, 220, 220)
+		pdf.RectFromUpperLeftWithStyle(pdfMargin, pdf.GetY(), tableWidth, pdfRowHeight, "F")
+		pdf.SetFillColor(0, 0, 0)
+		for _, column := range t.columns {
+			if err := cell(width, pdfRowHeight, fit(column), gopdf.AllBorders); err != nil {
+				return err
+			}
+		}
+		pdf.Br(pdfRowHeight)
+		return pdf.SetFont(pdfFont, "", 8)
+	}
+
+	if err := header(); err != nil {
+		return err
+	}
+	err = t.each(func(row map[string]any) error {
+		if pdf.GetY()+pdfRowHeight > pageHeight-pdfBottomMargin {
+			pdf.AddPage()
+			if err := header(); err != nil {
+				return err
+			}
+		}
+		for _, column := range t.columns {
+			if err := cell(width, pdfRowHeight, fit(cellString(row[column])), gopdf.AllBorders); err != nil {
+				return err
+			}
+		}
+		pdf.Br(pdfRowHeight)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return writePDF(w, pdf)
+}
+
+// writePDF numbers the pages of pdf in their footers, which is only possible
+// once every page was added, and writes it to w.
+func writePDF(w io.Writer, pdf *gopdf.GoPdf) error {
+	pageWidth, pageHeight := pdf.PointsToUnits(gopdf.PageSizeA4Landscape.W), pdf.PointsToUnits(gopdf.PageSizeA4Landscape.H)
+	pages := pdf.GetNumberOfPages()
+	for page := 1; page <= pages; page++ {
+		if err := pdf.SetPage(page); err != nil {
+			return err
+		}
+		if err := pdf.SetFont(pdfFont, "", 8); err != nil {
+			return err
+		}
+		pdf.SetXY(pdfMargin, pageHeight-12)
+		err := pdf.CellWithOption(&gopdf.Rect{W: pageWidth - 2*pdfMargin, H: pdfRowHeight}, fmt.Sprintf("Page %d of %d", page, pages), gopdf.CellOption{
+			Align: gopdf.Center | gopdf.Middle,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return pdf.Write(w)
+}
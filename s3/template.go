@@ -3,6 +3,7 @@ package s3
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/redhatinsights/export-service-go/models"
 )
@@ -19,6 +20,9 @@ type ExportMeta struct {
 	FileMeta    []ExportFileMeta `json:"file_meta"`
 	HelpString  string           `json:"help_string"`
 	FailedFiles []FailedFileMeta `json:"failed_files,omitempty"`
+	// MetadataFiles are the size and checksum of the README.md and
+	// errors.json of the archive
+	MetadataFiles []MetadataFileMeta `json:"metadata_files,omitempty"`
 }
 
 // details for each file in the tar
@@ -28,6 +32,18 @@ type ExportFileMeta struct {
 	Resource    string `json:"resource"`
 	// Filters are a key-value pair of the filters used to create the export
 	Filters map[string]interface{} `json:"filters"`
+	// Size and SHA256 are the size in bytes and the hex encoded SHA-256
+	// checksum of the file in the archive
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// MetadataFileMeta is the size in bytes and the hex encoded SHA-256 checksum
+// of a file which describes the export.
+type MetadataFileMeta struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
 }
 
 type FailedFileMeta struct {
@@ -65,6 +81,38 @@ func findFileMeta(id, basename string, sources []models.Source) (*ExportFileMeta
 	return nil, nil
 }
 
+// BuildFailedFiles describes the failed sources, and the errors that their
+// applications reported for them.
+func BuildFailedFiles(sources []models.Source) []FailedFileMeta {
+	var failed []FailedFileMeta
+	for _, source := range sources {
+		if source.Status != models.RFailed {
+			continue
+		}
+		failedFile := FailedFileMeta{
+			Filename:    fmt.Sprintf("%s.%s", source.ID, source.Format),
+			Application: source.Application,
+			Resource:    source.Resource,
+			Error:       ExportError{Message: "no error was reported"},
+		}
+		if source.SourceError != nil {
+			failedFile.Error = ExportError{Code: strconv.Itoa(source.Code), Message: source.Message}
+		}
+		failed = append(failed, failedFile)
+	}
+	return failed
+}
+
+// BuildErrors makes the errors.json file, which lists the failed files of
+// the export and their errors.
+func BuildErrors(meta *ExportMeta) ([]byte, error) {
+	failed := []FailedFileMeta{}
+	if meta != nil && meta.FailedFiles != nil {
+		failed = meta.FailedFiles
+	}
+	return json.Marshal(failed)
+}
+
 func BuildMeta(meta *ExportMeta) ([]byte, error) {
 	// make a json file from the ExportMeta struct
 	metaJSON, err := json.Marshal(meta)
@@ -3,9 +3,11 @@ package s3_test
 import (
 	"fmt"
 
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/redhatinsights/export-service-go/models"
 	"github.com/redhatinsights/export-service-go/s3"
 )
 
@@ -40,7 +42,7 @@ var _ = Describe("Build files included in zip", func() {
 		metaDump, err := s3.BuildMeta(&meta)
 
 		Expect(err).To(BeNil())
-		Expect(metaDump).To(Equal([]byte(`{"exported_by":"user","export_date":"date","export_org_id":"org_id","file_meta":[{"filename":"filename","application":"application","resource":"resource","filters":{"filter_key":"filter_value"}}],"help_string":"Help me!","failed_files":[{"filename":"filename","application":"application","resource":"resource","error":{"code":"code","message":"message"}}]}`)))
+		Expect(metaDump).To(Equal([]byte(`{"exported_by":"user","export_date":"date","export_org_id":"org_id","file_meta":[{"filename":"filename","application":"application","resource":"resource","filters":{"filter_key":"filter_value"},"size":0,"sha256":""}],"help_string":"Help me!","failed_files":[{"filename":"filename","application":"application","resource":"resource","error":{"code":"code","message":"message"}}]}`)))
 
 		// Error should never occur, not even for nil case
 		_, err = s3.BuildMeta(nil)
@@ -319,4 +321,36 @@ If you have any questions, or need support with this service, please contact Red
 			Expect(string(readme)).To(ContainSubstring(fmt.Sprintf("%s: %s", key, value)))
 		}
 	})
+	It("should describe the failed sources and their errors", func() {
+		completeID, failedID, unreportedID := uuid.New(), uuid.New(), uuid.New()
+		sources := []models.Source{
+			{ID: completeID, Application: "exampleApp", Resource: "exampleResource", Status: models.RComplete, Format: models.JSON},
+			{ID: failedID, Application: "exampleApp", Resource: "failingResource", Status: models.RFailed, Format: models.JSON, SourceError: &models.SourceError{Message: "the resource is unavailable", Code: 503}},
+			{ID: unreportedID, Application: "otherApp", Resource: "otherResource", Status: models.RFailed, Format: models.CSV},
+		}
+
+		meta := s3.ExportMeta{FailedFiles: s3.BuildFailedFiles(sources)}
+		Expect(meta.FailedFiles).To(Equal([]s3.FailedFileMeta{
+			{Filename: failedID.String() + ".json", Application: "exampleApp", Resource: "failingResource", Error: s3.ExportError{Code: "503", Message: "the resource is unavailable"}},
+			{Filename: unreportedID.String() + ".csv", Application: "otherApp", Resource: "otherResource", Error: s3.ExportError{Message: "no error was reported"}},
+		}))
+
+		readme, err := s3.BuildReadme(&meta)
+		Expect(err).To(BeNil())
+		Expect(readme).To(ContainSubstring("- **Error Message**: the resource is unavailable"))
+		Expect(readme).ToNot(ContainSubstring("No failures reported."))
+
+		errorsJSON, err := s3.BuildErrors(&meta)
+		Expect(err).To(BeNil())
+		Expect(errorsJSON).To(MatchJSON(fmt.Sprintf(`[
+			{"filename": "%s.json", "application": "exampleApp", "resource": "failingResource", "error": {"code": "503", "message": "the resource is unavailable"}},
+			{"filename": "%s.csv", "application": "otherApp", "resource": "otherResource", "error": {"code": "", "message": "no error was reported"}}
+		]`, failedID, unreportedID)))
+	})
+
+	It("should list no errors when no sources failed", func() {
+		errorsJSON, err := s3.BuildErrors(&s3.ExportMeta{})
+		Expect(err).To(BeNil())
+		Expect(errorsJSON).To(MatchJSON(`[]`))
+	})
 })
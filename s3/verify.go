@@ -0,0 +1,201 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+const (
+	metaFilename = "meta.json"
+	// signatureFilename is the detached signature of meta.json, the base64
+	// encoded ed25519 signature of its contents
+	signatureFilename = "meta.json.sig"
+	// zipEncryptedFlag is the general purpose flag of zip entries which are
+	// encrypted, with ZipCrypto or AES
+	zipEncryptedFlag = 0x1
+)
+
+// SignMeta returns the signature of meta.json which is added to archives.
+func SignMeta(metaJSON []byte, signingKey ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(signingKey, metaJSON)))
+}
+
+// archivedFile is the size and checksum of a file in an archive.
+type archivedFile struct {
+	size   int64
+	sha256 string
+}
+
+// VerifyArchive verifies the archive of an export stored at path: that its
+// meta.json is signed with the key of publicKey, unless it is nil, that
+// every file listed in meta.json has the size and checksum recorded there,
+// and that the archive has no other files. It returns the meta.json of the
+// archive.
+func VerifyArchive(path string, publicKey ed25519.PublicKey) (*ExportMeta, error) {
+	var (
+		files           = make(map[string]archivedFile)
+		names           []string
+		metaJSON, sig   []byte
+		hasMeta, hasSig bool
+	)
+	err := walkArchive(path, func(name string, r io.Reader) error {
+		switch name {
+		case metaFilename:
+			var err error
+			metaJSON, err = io.ReadAll(r)
+			hasMeta = true
+			return err
+		case signatureFilename:
+			var err error
+			sig, err = io.ReadAll(r)
+			hasSig = true
+			return err
+		}
+
+		checksum := sha256.New()
+		size, err := io.Copy(checksum, r)
+		if err != nil {
+			return err
+		}
+		files[name] = archivedFile{size, hex.EncodeToString(checksum.Sum(nil))}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasMeta {
+		return nil, fmt.Errorf("the archive has no %s", metaFilename)
+	}
+	if publicKey != nil {
+		if !hasSig {
+			return nil, fmt.Errorf("the archive has no signature")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || !ed25519.Verify(publicKey, metaJSON, decoded) {
+			return nil, fmt.Errorf("the signature of %s is not valid", metaFilename)
+		}
+	}
+
+	var meta ExportMeta
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", metaFilename, err)
+	}
+	var expected []MetadataFileMeta
+	for _, fileMeta := range meta.FileMeta {
+		expected = append(expected, MetadataFileMeta{fileMeta.Filename, fileMeta.Size, fileMeta.SHA256})
+	}
+	expected = append(expected, meta.MetadataFiles...)
+
+	listed := make(map[string]bool)
+	for _, fileMeta := range expected {
+		listed[fileMeta.Filename] = true
+		f, ok := files[fileMeta.Filename]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%s is missing from the archive", fileMeta.Filename)
+		case fileMeta.SHA256 == "":
+			return nil, fmt.Errorf("%s has no checksum", fileMeta.Filename)
+		case f.size != fileMeta.Size || f.sha256 != fileMeta.SHA256:
+			return nil, fmt.Errorf("%s does not match its checksum", fileMeta.Filename)
+		}
+	}
+	for _, name := range names {
+		if !listed[name] {
+			return nil, fmt.Errorf("%s is not listed in %s", name, metaFilename)
+		}
+	}
+	return &meta, nil
+}
+
+// walkArchive calls fn with the name and contents of every file in the
+// archive stored at path, whose format is given by its extension.
+func walkArchive(path string, fn func(name string, r io.Reader) error) error {
+	var format models.ArchiveFormat
+	for _, f := range models.ArchiveFormats {
+		if strings.HasSuffix(path, "."+string(f)) {
+			format = f
+		}
+	}
+	if format == "" {
+		return fmt.Errorf("%s is not a zip, tar.gz or tar.zst archive, encrypted archives have to be decrypted first", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if format == models.Zip {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, fi.Size())
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if zf.Flags&zipEncryptedFlag != 0 {
+				return fmt.Errorf("%s is password protected, its files have to be extracted with the password to be verified", path)
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var r io.Reader
+	if format == models.TarGz {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	} else {
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package s3_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/s3"
+)
+
+var _ = Describe("Verifying archives", func() {
+	const (
+		data   = `[{"id": 1}]`
+		readme = "# Export Manifest\n"
+	)
+
+	var publicKey ed25519.PublicKey
+	var signingKey ed25519.PrivateKey
+
+	BeforeEach(func() {
+		var err error
+		publicKey, signingKey, err = ed25519.GenerateKey(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	// writeArchive writes an archive with the files, whose contents are the
+	// values of files, and a meta.json with the checksums of data.json and
+	// README.md when their contents are data and readme.
+	writeArchive := func(format models.ArchiveFormat, files map[string]string, signed bool) string {
+		dataSum, readmeSum := sha256.Sum256([]byte(data)), sha256.Sum256([]byte(readme))
+		meta := s3.ExportMeta{
+			FileMeta: []s3.ExportFileMeta{
+				{Filename: "data.json", Size: int64(len(data)), SHA256: hex.EncodeToString(dataSum[:])},
+			},
+			MetadataFiles: []s3.MetadataFileMeta{
+				{Filename: "README.md", Size: int64(len(readme)), SHA256: hex.EncodeToString(readmeSum[:])},
+			},
+		}
+		metaJSON, err := s3.BuildMeta(&meta)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		files["meta.json"] = string(metaJSON)
+		if signed {
+			files["meta.json.sig"] = string(s3.SignMeta(metaJSON, signingKey))
+		}
+
+		path := filepath.Join(GinkgoT().TempDir(), "export."+string(format))
+		f, err := os.Create(path)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		archive, err := s3.NewArchiveWriter(f, format, *config.Get())
+		Expect(err).ShouldNot(HaveOccurred())
+		for name, body := range files {
+			w, err := archive.Create(name, int64(len(body)), time.Now())
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = io.WriteString(w, body)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(archive.Close()).To(Succeed())
+		return path
+	}
+
+	unchanged := func() map[string]string {
+		return map[string]string{"data.json": data, "README.md": readme}
+	}
+
+	DescribeTable("accepts archives which were not changed", func(format models.ArchiveFormat) {
+		meta, err := s3.VerifyArchive(writeArchive(format, unchanged(), true), publicKey)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(meta.FileMeta).To(HaveLen(1))
+	},
+		Entry("as a zip", models.Zip),
+		Entry("as a gzipped tarball", models.TarGz),
+		Entry("as a zstd compressed tarball", models.TarZst),
+	)
+
+	It("rejects files which were changed", func() {
+		_, err := s3.VerifyArchive(writeArchive(models.Zip, map[string]string{"data.json": `[{"id": 2}]`, "README.md": readme}, true), publicKey)
+		Expect(err).To(MatchError("data.json does not match its checksum"))
+
+		_, err = s3.VerifyArchive(writeArchive(models.Zip, map[string]string{"data.json": data, "README.md": "# Changed\n"}, true), publicKey)
+		Expect(err).To(MatchError("README.md does not match its checksum"))
+	})
+
+	It("rejects files which are not listed in meta.json", func() {
+		files := unchanged()
+		files["extra.json"] = data
+		_, err := s3.VerifyArchive(writeArchive(models.TarGz, files, true), publicKey)
+		Expect(err).To(MatchError("extra.json is not listed in meta.json"))
+	})
+
+	It("rejects files which are missing", func() {
+		_, err := s3.VerifyArchive(writeArchive(models.Zip, map[string]string{"data.json": data}, true), publicKey)
+		Expect(err).To(MatchError("README.md is missing from the archive"))
+	})
+
+	It("reports password protected zips", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "export.zip")
+		f, err := os.Create(path)
+		Expect(err).ShouldNot(HaveOccurred())
+		keys, err := s3.DeriveZipKeys("secret", 1)
+		Expect(err).ShouldNot(HaveOccurred())
+		archive := s3.NewPasswordZipWriter(f, keys)
+		w, err := archive.Create("data.json", int64(len(data)), time.Now())
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = io.WriteString(w, data)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(archive.Close()).To(Succeed())
+		Expect(f.Close()).To(Succeed())
+
+		_, err = s3.VerifyArchive(path, publicKey)
+		Expect(err).To(MatchError(path + " is password protected, its files have to be extracted with the password to be verified"))
+	})
+
+	It("rejects signatures of another key", func() {
+		otherKey, _, err := ed25519.GenerateKey(nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		_, err = s3.VerifyArchive(writeArchive(models.Zip, unchanged(), true), otherKey)
+		Expect(err).To(MatchError("the signature of meta.json is not valid"))
+	})
+
+	It("rejects archives which are not signed", func() {
+		_, err := s3.VerifyArchive(writeArchive(models.Zip, unchanged(), false), publicKey)
+		Expect(err).To(MatchError("the archive has no signature"))
+
+		_, err = s3.VerifyArchive(writeArchive(models.Zip, unchanged(), false), nil)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+})
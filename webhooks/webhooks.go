@@ -0,0 +1,335 @@
+/*
+Copyright 2022 Red Hat Inc.
+SPDX-License-Identifier: Apache-2.0
+*/
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/redhatinsights/export-service-go/config"
+	export_logger "github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+)
+
+// The headers sent with every notification. The signature is only sent if the
+// export has a callback secret.
+const (
+	DeliveryHeader  = "X-Export-Delivery"
+	TimestampHeader = "X-Export-Timestamp"
+	SignatureHeader = "X-Export-Signature"
+)
+
+// maxResponseSize is the amount of a response body that is read, so that the
+// connection can be reused. The body itself is ignored.
+const maxResponseSize = 64 << 10
+
+// Notification is the body of the request sent to the callback URL of an
+// export once it is finished. It has the same fields as the status of the
+// export in the public API.
+type Notification struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Expires     *time.Time `json:"expires_at,omitempty"`
+	Sources     []Source   `json:"sources"`
+}
+
+type Source struct {
+	ID          uuid.UUID `json:"id"`
+	Application string    `json:"application"`
+	Resource    string    `json:"resource"`
+	Status      string    `json:"status"`
+	Message     string    `json:"message,omitempty"`
+	Code        int       `json:"error,omitempty"`
+}
+
+// NewNotification returns the notification for the current state of export.
+func NewNotification(export *models.ExportPayload) Notification {
+	n := Notification{
+		ID:        export.ID,
+		Name:      export.Name,
+		CreatedAt: export.CreatedAt.UTC(),
+		Format:    string(export.Format),
+		Status:    string(export.Status),
+		Sources:   []Source{},
+	}
+	if export.CompletedAt != nil {
+		completed := export.CompletedAt.UTC()
+		n.CompletedAt = &completed
+	}
+	if export.Expires != nil {
+		expires := export.Expires.UTC()
+		n.Expires = &expires
+	}
+	for _, source := range export.Sources {
+		status := string(source.Status)
+		if status == "success" {
+			// legacy status of sources which are complete
+			status = string(models.RComplete)
+		}
+		s := Source{
+			ID:          source.ID,
+			Application: source.Application,
+			Resource:    source.Resource,
+			Status:      status,
+		}
+		if source.SourceError != nil {
+			s.Message = source.Message
+			s.Code = source.Code
+		}
+		n.Sources = append(n.Sources, s)
+	}
+	return n
+}
+
+// Sign returns the signature of a notification body sent at the given unix
+// time: the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with secret.
+// Including the timestamp lets receivers reject replayed notifications.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender notifies the callback URL of an export once it is finished. Failed
+// notifications are sent again according to Policy, and every attempt is
+// recorded as a models.WebhookDelivery.
+type Sender struct {
+	DB     models.DBInterface
+	Log    *zap.SugaredLogger
+	Client *http.Client
+	Policy config.RetryPolicy
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSender returns a Sender whose requests time out after timeout. Redirects
+// are not followed, the callback URL has to answer the notification itself,
+// and requests are only sent to public addresses. Proxies are not used, so
+// that the addresses are checked.
+func NewSender(db models.DBInterface, log *zap.SugaredLogger, timeout time.Duration, policy config.RetryPolicy) *Sender {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Sender{
+		DB:  db,
+		Log: log,
+		Client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         publicDialer(timeout).DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Policy: policy,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// errNotPublic is returned when a callback URL resolves to an address which
+// callbacks are not sent to.
+var errNotPublic = errors.New("the address is not public")
+
+// nonPublicPrefixes are the special purpose ranges which PublicAddress rejects
+// on top of private, loopback and link-local addresses.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // this network
+	netip.MustParsePrefix("100.64.0.0/10"),  // shared address space
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which reaches IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local NAT64
+	netip.MustParsePrefix("2001::/32"),      // Teredo
+	netip.MustParsePrefix("2002::/16"),      // 6to4
+}
+
+// PublicAddress reports whether addr is a public unicast address, which
+// callbacks may be sent to. Private, loopback and link-local addresses, such
+// as that of the metadata service of a cloud, are not public.
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicDialer returns a dialer which only connects to public addresses. The
+// address is checked once the host is resolved, for every connection, so
+// that a host can not resolve to another address after the callback URL was
+// accepted.
+func publicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !PublicAddress(addrPort.Addr()) {
+				return errNotPublic
+			}
+			return nil
+		},
+	}
+}
+
+// ExportFinished notifies the callback URL of the export, if it has one, in
+// the background.
+func (s *Sender) ExportFinished(exportID uuid.UUID) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.Deliver(s.ctx, exportID)
+	}()
+}
+
+// Close abandons the notifications which are waiting to be sent again, and
+// waits for those in progress.
+func (s *Sender) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Deliver sends the notification for the current state of the export to its
+// callback URL until it is accepted, the policy gives up or ctx is done. A
+// request which is already in progress is not interrupted by ctx, it is only
+// bounded by the timeout of the client.
+func (s *Sender) Deliver(ctx context.Context, exportID uuid.UUID) {
+	logger := s.Log.With(export_logger.ExportIDField(exportID.String()))
+
+	export, err := s.DB.Get(exportID)
+	if err != nil {
+		logger.Errorw("failed to get export for webhook", "error", err)
+		return
+	}
+	if export.CallbackURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(NewNotification(export))
+	if err != nil {
+		logger.Errorw("failed to encode webhook notification", "error", err)
+		return
+	}
+
+	deliveryID := uuid.New()
+	logger = logger.With("delivery_id", deliveryID, "status", export.Status)
+	for attempt := 1; ; attempt++ {
+		code, sendErr := s.send(export, deliveryID, body)
+
+		delivery := &models.WebhookDelivery{
+			ExportPayloadID: export.ID,
+			DeliveryID:      deliveryID,
+			URL:             export.CallbackURL,
+			Status:          export.Status,
+			Attempt:         attempt,
+			StatusCode:      code,
+			Delivered:       sendErr == nil,
+		}
+		if sendErr != nil {
+			delivery.Error = deliveryError(code, sendErr)
+		}
+		if err := s.DB.CreateWebhookDelivery(delivery); err != nil {
+			logger.Errorw("failed to record webhook delivery", "error", err)
+		}
+
+		if sendErr == nil {
+			logger.Infow("webhook delivered", "attempt", attempt)
+			return
+		}
+		if !retryable(code) || !s.Policy.Retries(code, attempt) {
+			logger.Warnw("giving up on webhook", "attempt", attempt, "error", sendErr)
+			return
+		}
+
+		delay := s.Policy.Delay(attempt)
+		logger.Infow("webhook failed, retrying", "attempt", attempt, "delay", delay, "error", sendErr)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send posts body to the callback URL of export once, and returns the status
+// code of the response, if any.
+func (s *Sender) send(export *models.ExportPayload, deliveryID uuid.UUID, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, export.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, deliveryID.String())
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if export.CallbackSecret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(export.CallbackSecret, timestamp, body))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliveryError returns the reason that a notification failed which is shown
+// to the user. The reason why a callback could not be reached is only logged,
+// since it tells which addresses and ports can be connected to.
+func deliveryError(code int, err error) string {
+	if code == 0 {
+		return "the callback URL could not be reached"
+	}
+	return err.Error()
+}
+
+// retryable reports whether a notification which failed with the given status
+// code may succeed when sent again. A code of 0 means there was no response.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,250 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/export-service-go/config"
+	"github.com/redhatinsights/export-service-go/logger"
+	"github.com/redhatinsights/export-service-go/models"
+	"github.com/redhatinsights/export-service-go/webhooks"
+)
+
+// fakeDB stores a single export and the deliveries recorded for it.
+type fakeDB struct {
+	models.DBInterface
+
+	mu         sync.Mutex
+	export     *models.ExportPayload
+	deliveries []*models.WebhookDelivery
+}
+
+func (db *fakeDB) Get(exportUUID uuid.UUID) (*models.ExportPayload, error) {
+	if db.export == nil || db.export.ID != exportUUID {
+		return nil, models.ErrRecordNotFound
+	}
+	return db.export, nil
+}
+
+func (db *fakeDB) CreateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.deliveries = append(db.deliveries, delivery)
+	return nil
+}
+
+func (db *fakeDB) recorded() []*models.WebhookDelivery {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]*models.WebhookDelivery{}, db.deliveries...)
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+var _ = Describe("Sender", func() {
+	var (
+		db       *fakeDB
+		server   *httptest.Server
+		requests chan received
+		statuses []int
+		sender   *webhooks.Sender
+	)
+
+	BeforeEach(func() {
+		requests = make(chan received, 10)
+		statuses = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests <- received{header: r.Header.Clone(), body: body}
+			status := http.StatusNoContent
+			if len(statuses) > 0 {
+				status, statuses = statuses[0], statuses[1:]
+			}
+			w.WriteHeader(status)
+		}))
+		DeferCleanup(server.Close)
+
+		completed := time.Now()
+		db = &fakeDB{export: &models.ExportPayload{
+			ID:             uuid.New(),
+			Name:           "Test Export",
+			Format:         models.CSV,
+			Status:         models.Partial,
+			CompletedAt:    &completed,
+			CallbackURL:    server.URL,
+			CallbackSecret: "s3cr3t",
+			Sources: []models.Source{
+				{ID: uuid.New(), Application: "exampleApp", Resource: "exampleResource", Status: "success"},
+				{ID: uuid.New(), Application: "exampleApp", Resource: "anotherExampleResource", Status: models.RFailed, SourceError: &models.SourceError{Message: "boom", Code: 500}},
+			},
+		}}
+
+		sender = webhooks.NewSender(db, logger.Get(), time.Second, config.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			MaxBackoff:  time.Millisecond,
+		})
+		// the test server listens on a loopback address
+		sender.Client.Transport = http.DefaultTransport
+	})
+
+	It("does not send notifications to addresses which are not public", func() {
+		sender = webhooks.NewSender(db, logger.Get(), time.Second, config.RetryPolicy{MaxAttempts: 1})
+		sender.Deliver(context.Background(), db.export.ID)
+
+		Expect(requests).ToNot(Receive())
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(1))
+		Expect(deliveries[0].Delivered).To(BeFalse())
+		Expect(deliveries[0].StatusCode).To(BeZero())
+		// the reason is not shown, it would tell which ports are open
+		Expect(deliveries[0].Error).To(Equal("the callback URL could not be reached"))
+	})
+
+	It("sends a signed notification of the export", func() {
+		sender.Deliver(context.Background(), db.export.ID)
+
+		var req received
+		Expect(requests).To(Receive(&req))
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.header.Get(webhooks.DeliveryHeader)).ToNot(BeEmpty())
+
+		timestamp, err := strconv.ParseInt(req.header.Get(webhooks.TimestampHeader), 10, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.header.Get(webhooks.SignatureHeader)).To(Equal("sha256=" + webhooks.Sign("s3cr3t", timestamp, req.body)))
+
+		var notification webhooks.Notification
+		Expect(json.Unmarshal(req.body, &notification)).To(Succeed())
+		Expect(notification.ID).To(Equal(db.export.ID))
+		Expect(notification.Format).To(Equal("csv"))
+		Expect(notification.Status).To(Equal("partial"))
+		Expect(notification.CompletedAt).ToNot(BeNil())
+		Expect(notification.Sources).To(HaveLen(2))
+		Expect(notification.Sources[0].Status).To(Equal("complete"))
+		Expect(notification.Sources[1].Message).To(Equal("boom"))
+		Expect(notification.Sources[1].Code).To(Equal(500))
+
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(1))
+		Expect(deliveries[0].Delivered).To(BeTrue())
+		Expect(deliveries[0].Attempt).To(Equal(1))
+		Expect(deliveries[0].StatusCode).To(Equal(http.StatusNoContent))
+		Expect(deliveries[0].Status).To(Equal(models.Partial))
+	})
+
+	It("does not sign the notification without a secret", func() {
+		db.export.CallbackSecret = ""
+		sender.Deliver(context.Background(), db.export.ID)
+
+		var req received
+		Expect(requests).To(Receive(&req))
+		Expect(req.header.Get(webhooks.SignatureHeader)).To(BeEmpty())
+	})
+
+	It("does nothing for an export without a callback URL", func() {
+		db.export.CallbackURL = ""
+		sender.Deliver(context.Background(), db.export.ID)
+
+		Expect(requests).ToNot(Receive())
+		Expect(db.recorded()).To(BeEmpty())
+	})
+
+	It("retries failed notifications with the same delivery ID", func() {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		sender.Deliver(context.Background(), db.export.ID)
+
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(3))
+		Expect(deliveries[0].StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(deliveries[0].Error).ToNot(BeEmpty())
+		Expect(deliveries[0].Delivered).To(BeFalse())
+		Expect(deliveries[1].StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(deliveries[2].Delivered).To(BeTrue())
+		Expect(deliveries[2].Attempt).To(Equal(3))
+
+		var ids []string
+		for range deliveries {
+			var req received
+			Expect(requests).To(Receive(&req))
+			ids = append(ids, req.header.Get(webhooks.DeliveryHeader))
+		}
+		Expect(ids).To(HaveEach(deliveries[0].DeliveryID.String()))
+	})
+
+	It("gives up once the policy is exhausted", func() {
+		statuses = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusNoContent}
+		sender.Deliver(context.Background(), db.export.ID)
+
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(3))
+		Expect(deliveries).To(HaveEach(HaveField("Delivered", false)))
+	})
+
+	It("does not retry notifications that were rejected", func() {
+		statuses = []int{http.StatusBadRequest}
+		sender.Deliver(context.Background(), db.export.ID)
+
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(1))
+		Expect(deliveries[0].StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("does not follow redirects", func() {
+		statuses = []int{http.StatusFound}
+		sender.Deliver(context.Background(), db.export.ID)
+
+		deliveries := db.recorded()
+		Expect(deliveries).To(HaveLen(1))
+		Expect(deliveries[0].StatusCode).To(Equal(http.StatusFound))
+		Expect(deliveries[0].Delivered).To(BeFalse())
+	})
+
+	It("sends notifications in the background until it is closed", func() {
+		sender.ExportFinished(db.export.ID)
+		sender.Close()
+
+		Expect(requests).To(Receive())
+		Expect(db.recorded()).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Sign", func() {
+	It("depends on the secret, timestamp and body", func() {
+		signature := webhooks.Sign("secret", 1700000000, []byte(`{"id":"1"}`))
+		Expect(signature).To(HaveLen(64))
+		Expect(webhooks.Sign("secret", 1700000000, []byte(`{"id":"1"}`))).To(Equal(signature))
+		Expect(webhooks.Sign("other", 1700000000, []byte(`{"id":"1"}`))).ToNot(Equal(signature))
+		Expect(webhooks.Sign("secret", 1700000001, []byte(`{"id":"1"}`))).ToNot(Equal(signature))
+		Expect(webhooks.Sign("secret", 1700000000, []byte(`{"id":"2"}`))).ToNot(Equal(signature))
+	})
+})
+
+var _ = DescribeTable("PublicAddress", func(addr string, public bool) {
+	Expect(webhooks.PublicAddress(netip.MustParseAddr(addr))).To(Equal(public))
+},
+	Entry("public IPv4", "93.184.215.14", true),
+	Entry("public IPv6", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", true),
+	Entry("loopback", "127.0.0.1", false),
+	Entry("IPv6 loopback", "::1", false),
+	Entry("private", "10.1.2.3", false),
+	Entry("IPv6 unique local", "fd00:ec2::254", false),
+	Entry("cloud metadata", "169.254.169.254", false),
+	Entry("unspecified", "0.0.0.0", false),
+	Entry("shared address space", "100.64.1.1", false),
+	Entry("IPv4-mapped private", "::ffff:192.168.1.1", false),
+	Entry("NAT64 of a private address", "64:ff9b::a01:203", false),
+)